@@ -43,6 +43,19 @@ func addConfigFlags(flags *pflag.FlagSet) {
 	flags.String("branding.name", "", "replace 'File Browser' by this name")
 	flags.String("branding.files", "", "path to directory with images and custom styles")
 	flags.Bool("branding.disableExternal", false, "disable external links such as GitHub links")
+
+	flags.String("reload.backend", settings.ReloadBackendShell, "reload backend: shell, command or webhook")
+	flags.String("reload.dir", settings.DefaultReloadDir, "working directory of the shell and command reload backends, relative to the user scope")
+	flags.String("reload.command", "", "command of the command reload backend, {proc} is replaced by the proc expression")
+	flags.String("reload.url", "", "url of the webhook reload backend")
+	flags.Uint("reload.timeout", 0, "timeout of a reload in seconds, 0 to disable")
+	flags.Bool("reload.staging", false, "stage the uploads of a session until it is committed or reloaded")
+	flags.String("reload.healthCheck", "", "command run between two reload waves, {proc} is replaced by the proc expression of the wave")
+	flags.Bool("reload.rollback", true, "roll the session back and reload the waves done when a reload wave fails")
+	flags.Bool("reload.requireApproval", false, "only reload or commit the upload sessions approved by a user with the approve perm, requires reload.staging")
+
+	flags.Bool("validation.disableXML", false, "do not check that uploaded xml files are well-formed")
+	flags.String("validation.sqlite", "", "sqlite3 binary checking the integrity of uploaded db files, the check is disabled by default")
 }
 
 //nolint:gocyclo
@@ -157,6 +170,31 @@ func printSettings(ser *settings.Server, set *settings.Settings, auther auth.Aut
 	fmt.Fprintf(w, "\t\tDelete:\t%t\n", set.Defaults.Perm.Delete)
 	fmt.Fprintf(w, "\t\tShare:\t%t\n", set.Defaults.Perm.Share)
 	fmt.Fprintf(w, "\t\tDownload:\t%t\n", set.Defaults.Perm.Download)
+	fmt.Fprintf(w, "\t\tApprove:\t%t\n", set.Defaults.Perm.Approve)
+	fmt.Fprintln(w, "\nReload:")
+	fmt.Fprintf(w, "\tBackend:\t%s\n", set.Reload.Backend.Type)
+	fmt.Fprintf(w, "\tDir:\t%s\n", set.Reload.Backend.Dir)
+	fmt.Fprintf(w, "\tCommand:\t%s\n", strings.Join(set.Reload.Backend.Command, " "))
+	fmt.Fprintf(w, "\tURL:\t%s\n", set.Reload.Backend.URL)
+	fmt.Fprintf(w, "\tTimeout:\t%d\n", set.Reload.Backend.Timeout)
+	fmt.Fprintf(w, "\tStaging:\t%t\n", set.Reload.Staging)
+	fmt.Fprintf(w, "\tHealth check:\t%s\n", strings.Join(set.Reload.HealthCheck, " "))
+	fmt.Fprintf(w, "\tRollback:\t%t\n", set.Reload.RollbackEnabled())
+	fmt.Fprintf(w, "\tRequire approval:\t%t\n", set.Reload.RequireApproval)
+	fmt.Fprintln(w, "\nValidation:")
+	fmt.Fprintf(w, "\tDisable XML:\t%t\n", set.Validation.DisableXML)
+	fmt.Fprintf(w, "\tSQLite:\t%s\n", set.Validation.SQLite)
+	for ext, command := range set.Validation.Commands {
+		fmt.Fprintf(w, "\t%s:\t%s\n", ext, strings.Join(command, " "))
+	}
+	fmt.Fprintln(w, "\nReload proc IDs:")
+	for name, id := range set.Reload.ProcMap {
+		fmt.Fprintf(w, "\t%s:\t%s\n", name, id)
+	}
+	fmt.Fprintln(w, "\nReload order:")
+	for name, after := range set.Reload.After {
+		fmt.Fprintf(w, "\t%s:\tafter %s\n", name, strings.Join(after, ","))
+	}
 	w.Flush()
 
 	b, err := json.MarshalIndent(auther, "", "  ")
@@ -28,6 +28,7 @@ override the options.`,
 		flags := cmd.Flags()
 		getUserDefaults(flags, &defaults, true)
 		authMethod, auther := getAuthentication(flags)
+		rollback := mustGetBool(flags, "reload.rollback")
 
 		s := &settings.Settings{
 			Key:        generateKey(),
@@ -40,6 +41,23 @@ override the options.`,
 				DisableExternal: mustGetBool(flags, "branding.disableExternal"),
 				Files:           mustGetString(flags, "branding.files"),
 			},
+			Reload: settings.Reload{
+				Backend: settings.ReloadBackend{
+					Type:    mustGetString(flags, "reload.backend"),
+					Dir:     mustGetString(flags, "reload.dir"),
+					Command: strings.Fields(mustGetString(flags, "reload.command")),
+					URL:     mustGetString(flags, "reload.url"),
+					Timeout: int(mustGetUint(flags, "reload.timeout")),
+				},
+				Staging:         mustGetBool(flags, "reload.staging"),
+				HealthCheck:     strings.Fields(mustGetString(flags, "reload.healthCheck")),
+				Rollback:        &rollback,
+				RequireApproval: mustGetBool(flags, "reload.requireApproval"),
+			},
+			Validation: settings.Validation{
+				DisableXML: mustGetBool(flags, "validation.disableXML"),
+				SQLite:     mustGetString(flags, "validation.sqlite"),
+			},
 		}
 
 		ser := &settings.Server{
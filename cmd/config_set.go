@@ -57,6 +57,29 @@ you want to change. Other options will remain unchanged.`,
 				set.Branding.DisableExternal = mustGetBool(flags, flag.Name)
 			case "branding.files":
 				set.Branding.Files = mustGetString(flags, flag.Name)
+			case "reload.backend":
+				set.Reload.Backend.Type = mustGetString(flags, flag.Name)
+			case "reload.dir":
+				set.Reload.Backend.Dir = mustGetString(flags, flag.Name)
+			case "reload.command":
+				set.Reload.Backend.Command = strings.Fields(mustGetString(flags, flag.Name))
+			case "reload.url":
+				set.Reload.Backend.URL = mustGetString(flags, flag.Name)
+			case "reload.timeout":
+				set.Reload.Backend.Timeout = int(mustGetUint(flags, flag.Name))
+			case "reload.staging":
+				set.Reload.Staging = mustGetBool(flags, flag.Name)
+			case "reload.healthCheck":
+				set.Reload.HealthCheck = strings.Fields(mustGetString(flags, flag.Name))
+			case "reload.rollback":
+				rollback := mustGetBool(flags, flag.Name)
+				set.Reload.Rollback = &rollback
+			case "reload.requireApproval":
+				set.Reload.RequireApproval = mustGetBool(flags, flag.Name)
+			case "validation.disableXML":
+				set.Validation.DisableXML = mustGetBool(flags, flag.Name)
+			case "validation.sqlite":
+				set.Validation.SQLite = mustGetString(flags, flag.Name)
 			}
 		})
 
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/filebrowser/filebrowser/v2/history"
+	"github.com/filebrowser/filebrowser/v2/reload"
+)
+
+func init() {
+	reloadCmd.AddCommand(reloadHistoryCmd)
+
+	reloadHistoryCmd.Flags().String("user", "", "only show the reloads of this user")
+	reloadHistoryCmd.Flags().String("uuid", "", "only show the reloads of this upload session")
+	reloadHistoryCmd.Flags().String("since", "", `only show the reloads since this time, e.g. "2006-01-02"`)
+	reloadHistoryCmd.Flags().String("until", "", "only show the reloads before this time")
+	reloadHistoryCmd.Flags().Uint("limit", 0, "maximum number of reloads to show, 0 for all")
+	reloadHistoryCmd.Flags().Bool("files", false, "show the files and checksums of each reload")
+}
+
+var reloadHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the reloads and rollbacks of upload sessions",
+	Long: `List the reloads and rollbacks of upload sessions, the
+latest first. Times are either RFC 3339 or local times such as
+"2006-01-02" or "2006-01-02 15:04:05".`,
+	Args: cobra.NoArgs,
+	Run: python(func(cmd *cobra.Command, args []string, d pythonData) {
+		flags := cmd.Flags()
+		q := &history.Query{
+			UUID:  mustGetString(flags, "uuid"),
+			Limit: int(mustGetUint(flags, "limit")),
+		}
+
+		if name := mustGetString(flags, "user"); name != "" {
+			u, err := d.store.Users.Get("", name)
+			checkErr(err)
+			q.UserID = u.ID
+		}
+
+		var err error
+		if since := mustGetString(flags, "since"); since != "" {
+			q.Since, err = history.ParseTime(since)
+			checkErr(err)
+		}
+		if until := mustGetString(flags, "until"); until != "" {
+			q.Until, err = history.ParseTime(until)
+			checkErr(err)
+		}
+
+		entries, err := d.store.History.Find(q)
+		checkErr(err)
+		printHistory(entries, mustGetBool(flags, "files"))
+	}, pythonConfig{}),
+}
+
+func printHistory(entries []*history.Entry, files bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTime\tUser\tAction\tSession\tProc\tStatus\tFiles\tFailed")
+	for _, e := range entries {
+		failed := 0
+		for _, res := range e.Results {
+			if res.Status == reload.StatusFailed {
+				failed++
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", e.ID, e.Time.Format("2006-01-02 15:04:05"),
+			e.Username, e.Action, e.UUID, e.Proc, e.Status, len(e.Files), failed)
+
+		if !files {
+			continue
+		}
+		for _, f := range e.Files {
+			sum := f.SHA256
+			if sum == "" {
+				sum = "(deleted)"
+			}
+			if f.Created {
+				sum += " (created)"
+			}
+			fmt.Fprintf(w, "\t%s\t%s\n", f.Path, sum)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func init() {
+	rootCmd.AddCommand(reloadMapCmd)
+}
+
+var reloadMapCmd = &cobra.Command{
+	Use:   "reload-map",
+	Short: "Server name to proc ID mapping management utility",
+	Long: `Server name to proc ID mapping management utility.
+
+The server names of SvrLoadList.xml are mapped to the proc IDs
+which are reloaded when one of the db, xml or ServerConfig files
+they load changes:
+
+  <server name="GameSvr">
+    <excel name="item"/>            item.db
+    <xml name="GameSvr*.xml"/>      ClientConfig xml file names
+    <svrconfig path="GameSvr"/>     files and dirs under ServerConfig
+  </server>
+
+The xml and ServerConfig files no server declares reload every
+process.
+
+A proc ID has the form "world.zone.func.inst", where each part
+is either a number or "*". A server mapped to an empty proc ID
+is skipped, and reloading fails if SvrLoadList.xml references
+a server which is not mapped.`,
+	Args: cobra.NoArgs,
+}
+
+func printProcMap(r *settings.Reload) {
+	names := make([]string, 0, len(r.ProcMap))
+	for name := range r.ProcMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	levels, err := r.Levels()
+	checkErr(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Server\tProc ID\tAfter\tWave")
+	for _, name := range names {
+		id := r.ProcMap[name]
+		if id == "" {
+			id = "(skipped)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", name, id, strings.Join(r.After[name], ","), levels[name]+1)
+	}
+	w.Flush()
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	reloadMapCmd.AddCommand(reloadMapLsCmd)
+}
+
+var reloadMapLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the proc ID of each server",
+	Long:  `List the proc ID of each server, the servers it is reloaded after and its wave.`,
+	Args:  cobra.NoArgs,
+	Run: python(func(cmd *cobra.Command, args []string, d pythonData) {
+		s, err := d.store.Settings.Get()
+		checkErr(err)
+		printProcMap(&s.Reload)
+	}, pythonConfig{}),
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	reloadMapCmd.AddCommand(reloadMapRmCmd)
+}
+
+var reloadMapRmCmd = &cobra.Command{
+	Use:   "rm <server>",
+	Short: "Remove the mapping of a server",
+	Long: `Remove the mapping of a server, and the server from the reload
+order. Reloading fails as long as SvrLoadList.xml references a
+server which is not mapped.`,
+	Args: cobra.ExactArgs(1),
+	Run: python(func(cmd *cobra.Command, args []string, d pythonData) {
+		s, err := d.store.Settings.Get()
+		checkErr(err)
+		delete(s.Reload.ProcMap, args[0])
+		// the reload order only references mapped servers
+		delete(s.Reload.After, args[0])
+		for name, after := range s.Reload.After {
+			kept := after[:0]
+			for _, dep := range after {
+				if dep != args[0] {
+					kept = append(kept, dep)
+				}
+			}
+			s.Reload.After[name] = kept
+		}
+		err = d.store.Settings.Save(s)
+		checkErr(err)
+		printProcMap(&s.Reload)
+	}, pythonConfig{}),
+}
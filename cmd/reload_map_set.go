@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func init() {
+	reloadMapCmd.AddCommand(reloadMapSetCmd)
+	reloadMapSetCmd.Flags().Bool("skip", false, "skip the server instead of mapping it to a proc ID")
+	reloadMapSetCmd.Flags().StringSlice("after", nil, "the servers reloaded before this one, replaces the previous ones")
+}
+
+var reloadMapSetCmd = &cobra.Command{
+	Use:   "set <server> [proc_id]",
+	Short: "Map a server to a proc ID",
+	Long: `Map a server to a proc ID, such as "*.*.13.*". Use the
+"skip" flag instead of a proc ID for servers which must not
+be reloaded.
+
+The "after" flag sets the servers reloaded before this one,
+the proc ID may be omitted if the server is already mapped:
+
+  filebrowser reload-map set MatchSvr --after GameSvr
+
+The servers are then reloaded in waves, a wave starting once
+the previous one succeeded.`,
+	Args: cobra.RangeArgs(1, 2), //nolint:mnd
+	Run: python(func(cmd *cobra.Command, args []string, d pythonData) {
+		s, err := d.store.Settings.Get()
+		checkErr(err)
+
+		flags := cmd.Flags()
+		id, mapped := s.Reload.ProcMap[args[0]]
+		switch {
+		case mustGetBool(flags, "skip"):
+			id = ""
+		case len(args) == 2: //nolint:mnd
+			id = args[1]
+			checkErr(settings.ValidateProcID(id))
+		case !mapped || !flags.Changed("after"):
+			checkErr(cmd.Help())
+			return
+		}
+		s.Reload.ProcMap[args[0]] = id
+
+		if flags.Changed("after") {
+			after, err := flags.GetStringSlice("after")
+			checkErr(err)
+			if s.Reload.After == nil {
+				s.Reload.After = map[string][]string{}
+			}
+			if len(after) == 0 {
+				delete(s.Reload.After, args[0])
+			} else {
+				s.Reload.After[args[0]] = after
+			}
+		}
+
+		err = d.store.Settings.Save(s)
+		checkErr(err)
+		printProcMap(&s.Reload)
+	}, pythonConfig{}),
+}
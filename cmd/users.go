@@ -27,10 +27,10 @@ var usersCmd = &cobra.Command{
 
 func printUsers(usrs []*users.User) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tUsername\tScope\tLocale\tV. Mode\tAdmin\tExecute\tCreate\tRename\tModify\tDelete\tShare\tDownload\tPwd Lock")
+	fmt.Fprintln(w, "ID\tUsername\tScope\tLocale\tV. Mode\tAdmin\tExecute\tCreate\tRename\tModify\tDelete\tShare\tDownload\tApprove\tPwd Lock")
 
 	for _, u := range usrs {
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t\n",
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t\n",
 			u.ID,
 			u.Username,
 			u.Scope,
@@ -44,6 +44,7 @@ func printUsers(usrs []*users.User) {
 			u.Perm.Delete,
 			u.Perm.Share,
 			u.Perm.Download,
+			u.Perm.Approve,
 			u.LockPassword,
 		)
 	}
@@ -68,6 +69,7 @@ func addUserFlags(flags *pflag.FlagSet) {
 	flags.Bool("perm.delete", true, "delete perm for users")
 	flags.Bool("perm.share", true, "share perm for users")
 	flags.Bool("perm.download", true, "download perm for users")
+	flags.Bool("perm.approve", false, "approve perm for users, to review the upload sessions which need approval")
 	flags.String("sorting.by", "name", "sorting mode (name, size or modified)")
 	flags.Bool("sorting.asc", false, "sorting by ascending order")
 	flags.Bool("lockPassword", false, "lock password")
@@ -111,6 +113,8 @@ func getUserDefaults(flags *pflag.FlagSet, defaults *settings.UserDefaults, all
 			defaults.Perm.Share = mustGetBool(flags, flag.Name)
 		case "perm.download":
 			defaults.Perm.Download = mustGetBool(flags, flag.Name)
+		case "perm.approve":
+			defaults.Perm.Approve = mustGetBool(flags, flag.Name)
 		case "commands":
 			commands, err := flags.GetStringSlice(flag.Name)
 			checkErr(err)
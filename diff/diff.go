@@ -0,0 +1,25 @@
+// Package diff compares two versions of a config file at the level of its
+// content: the rows of the tables of SQLite databases and the elements of
+// xml files.
+package diff
+
+// Kind is the kind of a change.
+type Kind string
+
+const (
+	Added    Kind = "added"
+	Removed  Kind = "removed"
+	Modified Kind = "modified"
+)
+
+// Change is the change of a field, a column of a row or an attribute of an
+// element. Old is empty for an added field, New for a removed one.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// MaxRows is the maximum number of changed rows or elements reported by
+// table or file, the others are only counted.
+const MaxRows = 1000
@@ -0,0 +1,98 @@
+package diff
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXML(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	old := write("old.xml", `<root>
+	<item id="1" price="10"/>
+	<item id="2" price="20"><tag>a</tag></item>
+	<group><x/></group>
+</root>`)
+	cur := write("new.xml", `<root>
+	<item id="2" price="25"><tag>b</tag></item>
+	<item id="3" price="30"><tag>c</tag></item>
+	<group><x/></group>
+</root>`)
+
+	res, err := XML(old, cur)
+	require.NoError(t, err)
+	require.Len(t, res.Nodes, 4)
+	assert.Equal(t, &Node{Kind: Modified, Path: "/root[1]/item[id=2]",
+		Changes: []*Change{{Field: "price", Old: "20", New: "25"}}}, res.Nodes[0])
+	assert.Equal(t, &Node{Kind: Modified, Path: "/root[1]/item[id=2]/tag[1]",
+		Changes: []*Change{{Field: "#text", Old: "a", New: "b"}}}, res.Nodes[1])
+	// the children of the added item are not reported on their own
+	assert.Equal(t, Added, res.Nodes[2].Kind)
+	assert.Equal(t, "/root[1]/item[id=3]", res.Nodes[2].Path)
+	assert.Equal(t, &Node{Kind: Removed, Path: "/root[1]/item[id=1]",
+		Changes: []*Change{{Field: "id", Old: "1"}, {Field: "price", Old: "10"}}}, res.Nodes[3])
+
+	// a new file is a single added root
+	res, err = XML("", cur)
+	require.NoError(t, err)
+	require.Len(t, res.Nodes, 1)
+	assert.Equal(t, "/root[1]", res.Nodes[0].Path)
+}
+
+func TestSQLite(t *testing.T) {
+	bin, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not found")
+	}
+
+	dir := t.TempDir()
+	create := func(name, sql string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, exec.Command(bin, path, sql).Run())
+		return path
+	}
+
+	old := create("old.db", `CREATE TABLE item (id INTEGER PRIMARY KEY, name TEXT, price INT);
+INSERT INTO item VALUES (1, 'sword', 10), (2, 'shield', 20);
+CREATE TABLE tag (name TEXT);
+INSERT INTO tag VALUES ('a'), ('a');
+CREATE TABLE gone (x INT);`)
+	cur := create("new.db", `CREATE TABLE item (id INTEGER PRIMARY KEY, name TEXT, price INT);
+INSERT INTO item VALUES (1, 'sword', 15), (3, 'bow', NULL);
+CREATE TABLE tag (name TEXT);
+INSERT INTO tag VALUES ('a'), ('b');`)
+
+	tables, err := SQLite(bin, old, cur)
+	require.NoError(t, err)
+	require.Len(t, tables, 3)
+
+	assert.Equal(t, "gone", tables[0].Name)
+	assert.Equal(t, Removed, tables[0].Kind)
+
+	item := tables[1]
+	assert.Equal(t, []string{"id"}, item.Key)
+	assert.Equal(t, 1, item.Added)
+	assert.Equal(t, 1, item.Removed)
+	assert.Equal(t, 1, item.Modified)
+	assert.Equal(t, &Row{Kind: Modified, Key: "id=1",
+		Changes: []*Change{{Field: "price", Old: "10", New: "15"}}}, item.Rows[0])
+	assert.Equal(t, &Row{Kind: Added, Key: "id=3", Changes: []*Change{
+		{Field: "id", New: "3"}, {Field: "name", New: "bow"}, {Field: "price", New: "NULL"}}}, item.Rows[1])
+	assert.Equal(t, Removed, item.Rows[2].Kind)
+
+	// the rows without primary key are only added or removed
+	tag := tables[2]
+	assert.Equal(t, 1, tag.Added)
+	assert.Equal(t, 1, tag.Removed)
+	assert.Equal(t, 0, tag.Modified)
+}
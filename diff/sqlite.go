@@ -0,0 +1,284 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeout of a sqlite3 query.
+const Timeout = time.Minute
+
+// Table is the changes of a table of a SQLite database. The rows are
+// identified by the primary key of the table, the rows of the tables
+// without one are only added or removed.
+type Table struct {
+	Name           string   `json:"name"`
+	Kind           Kind     `json:"kind"`
+	Key            []string `json:"key"`
+	AddedColumns   []string `json:"addedColumns,omitempty"`
+	RemovedColumns []string `json:"removedColumns,omitempty"`
+	Added          int      `json:"added"`
+	Removed        int      `json:"removed"`
+	Modified       int      `json:"modified"`
+	Rows           []*Row   `json:"rows"`
+	Truncated      bool     `json:"truncated,omitempty"` // more than MaxRows rows changed
+}
+
+// Row is the change of a row, Key shows its primary key such as "id=3".
+// The changes of an added or removed row hold all its columns.
+type Row struct {
+	Kind    Kind      `json:"kind"`
+	Key     string    `json:"key,omitempty"`
+	Changes []*Change `json:"changes"`
+}
+
+type table struct {
+	columns []string
+	key     []string
+	rows    []map[string]string
+}
+
+// SQLite compares the tables of the SQLite databases at oldPath and
+// newPath with the sqlite3 binary bin, oldPath is empty if the database is
+// new. The tables without changes are left out.
+func SQLite(bin, oldPath, newPath string) ([]*Table, error) {
+	before := map[string]*table{}
+	if oldPath != "" {
+		var err error
+		if before, err = readTables(bin, oldPath); err != nil {
+			return nil, err
+		}
+	}
+	after, err := readTables(bin, newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(before)+len(after))
+	for name := range after {
+		names = append(names, name)
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	tables := []*Table{}
+	for _, name := range names {
+		o, n := before[name], after[name]
+		t := &Table{Name: name, Kind: Modified, Rows: []*Row{}}
+		switch {
+		case o == nil:
+			t.Kind = Added
+			o = &table{columns: n.columns, key: n.key}
+		case n == nil:
+			t.Kind = Removed
+			n = &table{columns: o.columns, key: o.key}
+		default:
+			t.AddedColumns = missing(n.columns, o.columns)
+			t.RemovedColumns = missing(o.columns, n.columns)
+		}
+		diffRows(t, o, n)
+		if t.Kind != Modified || t.Added+t.Removed+t.Modified > 0 ||
+			len(t.AddedColumns) > 0 || len(t.RemovedColumns) > 0 {
+			tables = append(tables, t)
+		}
+	}
+	return tables, nil
+}
+
+// diffRows compares the rows of the columns of both versions of a table.
+func diffRows(t *Table, o, n *table) {
+	common := make([]string, 0, len(n.columns))
+	for _, c := range n.columns {
+		if len(missing([]string{c}, o.columns)) == 0 {
+			common = append(common, c)
+		}
+	}
+	// without the same primary key, a row is only identified by its content
+	key := n.key
+	if strings.Join(o.key, "\x00") != strings.Join(n.key, "\x00") {
+		key = nil
+	}
+	t.Key = key
+	if t.Key == nil {
+		t.Key = []string{}
+	}
+
+	add := func(row *Row) {
+		if len(t.Rows) == MaxRows {
+			t.Truncated = true
+			return
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	oldKeys := rowKeys(o.rows, key, common)
+	old := map[string]map[string]string{}
+	for _, k := range oldKeys {
+		old[k.id] = k.row
+	}
+	seen := map[string]bool{}
+	for _, k := range rowKeys(n.rows, key, common) {
+		or, found := old[k.id]
+		if !found {
+			t.Added++
+			add(&Row{Kind: Added, Key: k.show, Changes: rowChanges(n.columns, nil, k.row)})
+			continue
+		}
+		seen[k.id] = true
+		if changes := rowChanges(common, or, k.row); len(changes) > 0 {
+			t.Modified++
+			add(&Row{Kind: Modified, Key: k.show, Changes: changes})
+		}
+	}
+	for _, k := range oldKeys {
+		if !seen[k.id] {
+			t.Removed++
+			add(&Row{Kind: Removed, Key: k.show, Changes: rowChanges(o.columns, k.row, nil)})
+		}
+	}
+}
+
+type rowKey struct {
+	id   string
+	show string
+	row  map[string]string
+}
+
+// rowKeys identifies the rows by the columns of key, or by the columns of
+// common if key is empty, the duplicates by their occurrence.
+func rowKeys(rows []map[string]string, key, common []string) []*rowKey {
+	cols := key
+	if len(cols) == 0 {
+		cols = common
+	}
+
+	keys := make([]*rowKey, 0, len(rows))
+	count := map[string]int{}
+	for _, row := range rows {
+		vals := make([]string, len(cols))
+		shown := make([]string, len(key))
+		for i, c := range cols {
+			vals[i] = row[c]
+		}
+		for i, c := range key {
+			shown[i] = c + "=" + row[c]
+		}
+		id := strings.Join(vals, "\x00")
+		count[id]++
+		if len(key) == 0 {
+			id += "\x00" + strconv.Itoa(count[id])
+		}
+		keys = append(keys, &rowKey{id: id, show: strings.Join(shown, ", "), row: row})
+	}
+	return keys
+}
+
+// rowChanges compares the columns of two versions of a row, either may be
+// nil.
+func rowChanges(columns []string, o, n map[string]string) []*Change {
+	changes := []*Change{}
+	for _, c := range columns {
+		if o != nil && n != nil && o[c] == n[c] {
+			continue
+		}
+		changes = append(changes, &Change{Field: c, Old: o[c], New: n[c]})
+	}
+	return changes
+}
+
+// missing returns the strings of a which are not in b.
+func missing(a, b []string) []string {
+	var res []string
+	for _, s := range a {
+		found := false
+		for _, t := range b {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// readTables reads the tables of the database with their rows.
+func readTables(bin, path string) (map[string]*table, error) {
+	records, err := query(bin, path, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%';")
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]*table, len(records))
+	for _, rec := range records {
+		name := rec[0]
+		t := &table{}
+		info, err := query(bin, path, fmt.Sprintf("PRAGMA table_info(%s);", quoteIdent(name)))
+		if err != nil {
+			return nil, err
+		}
+		// cid, name, type, notnull, dflt_value, pk: the position in the key
+		pk := map[int]string{}
+		for _, col := range info {
+			t.columns = append(t.columns, col[1])
+			if n, _ := strconv.Atoi(col[5]); n > 0 {
+				pk[n] = col[1]
+			}
+		}
+		for i := 1; i <= len(pk); i++ {
+			t.key = append(t.key, pk[i])
+		}
+
+		rows, err := query(bin, path, fmt.Sprintf("SELECT * FROM %s;", quoteIdent(name)))
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range rows {
+			row := make(map[string]string, len(t.columns))
+			for i, c := range t.columns {
+				if i < len(rec) {
+					row[c] = rec[i]
+				}
+			}
+			t.rows = append(t.rows, row)
+		}
+		tables[name] = t
+	}
+	return tables, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// query runs the sql on the database with bin, NULL values are shown as
+// NULL.
+func query(bin, path, sql string) ([][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, "-batch", "-readonly", "-csv", "-nullvalue", "NULL", path, sql) //nolint:gosec
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", bin, err, strings.TrimSpace(stderr.String()))
+	}
+
+	r := csv.NewReader(&out)
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// textField is the field of the changes of the text of an element.
+const textField = "#text"
+
+// keyAttrs are the attributes identifying an element among its siblings,
+// the elements without them are identified by their position.
+var keyAttrs = []string{"id", "ID", "Id", "name"}
+
+// Node is the change of an element of an xml file, identified by its path
+// from the root such as "/root/item[id=3]" or "/root/group[2]". The
+// elements of an added or removed node are not reported on their own.
+type Node struct {
+	Kind    Kind      `json:"kind"`
+	Path    string    `json:"path"`
+	Changes []*Change `json:"changes"`
+}
+
+// XMLDiff is the changes of an xml file.
+type XMLDiff struct {
+	Nodes     []*Node `json:"nodes"`
+	Truncated bool    `json:"truncated,omitempty"` // more than MaxRows nodes changed
+}
+
+type element struct {
+	path   string
+	parent string
+	attrs  map[string]string
+	text   string
+}
+
+// XML compares the elements of the xml files at oldPath and newPath,
+// oldPath is empty if the file is new.
+func XML(oldPath, newPath string) (*XMLDiff, error) {
+	var before []*element
+	if oldPath != "" {
+		var err error
+		if before, err = readXML(oldPath); err != nil {
+			return nil, err
+		}
+	}
+	after, err := readXML(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return diffElements(before, after), nil
+}
+
+func diffElements(before, after []*element) *XMLDiff {
+	res := &XMLDiff{Nodes: []*Node{}}
+	add := func(n *Node) {
+		if len(res.Nodes) == MaxRows {
+			res.Truncated = true
+			return
+		}
+		res.Nodes = append(res.Nodes, n)
+	}
+
+	old := make(map[string]*element, len(before))
+	for _, e := range before {
+		old[e.path] = e
+	}
+	cur := make(map[string]*element, len(after))
+	for _, e := range after {
+		cur[e.path] = e
+	}
+
+	for _, e := range after {
+		if o, found := old[e.path]; found {
+			if changes := elementChanges(o, e); len(changes) > 0 {
+				add(&Node{Kind: Modified, Path: e.path, Changes: changes})
+			}
+			continue
+		}
+		// the children of an added element are part of it
+		if cur[e.parent] != nil && old[e.parent] == nil {
+			continue
+		}
+		add(&Node{Kind: Added, Path: e.path, Changes: elementChanges(nil, e)})
+	}
+	for _, e := range before {
+		if cur[e.path] != nil || (old[e.parent] != nil && cur[e.parent] == nil) {
+			continue
+		}
+		add(&Node{Kind: Removed, Path: e.path, Changes: elementChanges(e, nil)})
+	}
+	return res
+}
+
+// elementChanges compares the attributes and the text of two versions of
+// an element, either may be nil.
+func elementChanges(o, e *element) []*Change {
+	empty := &element{attrs: map[string]string{}}
+	if o == nil {
+		o = empty
+	}
+	if e == nil {
+		e = empty
+	}
+
+	names := make([]string, 0, len(o.attrs)+len(e.attrs))
+	for name := range o.attrs {
+		names = append(names, name)
+	}
+	for name := range e.attrs {
+		if _, ok := o.attrs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []*Change{}
+	for _, name := range names {
+		before, inOld := o.attrs[name]
+		after, inNew := e.attrs[name]
+		if before != after || inOld != inNew {
+			changes = append(changes, &Change{Field: name, Old: before, New: after})
+		}
+	}
+	if o.text != e.text {
+		changes = append(changes, &Change{Field: textField, Old: o.text, New: e.text})
+	}
+	return changes
+}
+
+type frame struct {
+	el    *element
+	text  strings.Builder
+	count map[string]int
+	used  map[string]bool
+}
+
+// readXML lists the elements of the xml file in document order.
+func readXML(path string) ([]*element, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var elements []*element
+	root := &frame{el: &element{}, count: map[string]int{}, used: map[string]bool{}}
+	stack := []*frame{root}
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %v", path, err)
+		}
+
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{parent: top.el.path, attrs: map[string]string{}}
+			for _, a := range t.Attr {
+				e.attrs[a.Name.Local] = a.Value
+			}
+			e.path = top.el.path + "/" + top.segment(t.Name.Local, e.attrs)
+			elements = append(elements, e)
+			stack = append(stack, &frame{el: e, count: map[string]int{}, used: map[string]bool{}})
+		case xml.CharData:
+			top.text.Write(t)
+		case xml.EndElement:
+			top.el.text = strings.TrimSpace(top.text.String())
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return elements, nil
+}
+
+// segment names the child element name of the frame by its key attribute,
+// or by its position among the children with the same name.
+func (f *frame) segment(name string, attrs map[string]string) string {
+	f.count[name]++
+	for _, key := range keyAttrs {
+		v, ok := attrs[key]
+		if !ok {
+			continue
+		}
+		seg := fmt.Sprintf("%s[%s=%s]", name, key, v)
+		if !f.used[seg] {
+			f.used[seg] = true
+			return seg
+		}
+		break
+	}
+	return name + "[" + strconv.Itoa(f.count[name]) + "]"
+}
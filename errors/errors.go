@@ -17,5 +17,8 @@ var (
 	ErrPermissionDenied     = errors.New("permission denied")
 	ErrInvalidRequestParams = errors.New("invalid request params")
 	ErrSourceIsParent       = errors.New("source is parent")
-	ErrCacheFailed			= errors.New("cache illegal data")
+	ErrCacheFailed          = errors.New("cache illegal data")
+	ErrSessionConflict      = errors.New("the files are modified by another upload session")
+	ErrInvalidConfig        = errors.New("invalid config file")
+	ErrReloadFailed         = errors.New("reload failed")
 )
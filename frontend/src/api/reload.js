@@ -1,10 +1,37 @@
-import { fetchURL } from './utils'
+import { fetchURL, fetchJSON } from './utils'
 import store from '@/store'
 
 export async function reload() {
     return reloadAction('GET')
 }
 
+// the changes of the tables and xml elements of a session, the current one by default
+export async function diff(uuid = store.state.uuid) {
+    return fetchJSON(`/api/reload/diff?uuid=${uuid}`, {})
+}
+
+// the upload sessions of the given state, such as "pending" for those to review
+export async function sessions(state) {
+    return fetchJSON(`/api/reload/sessions?state=${state || ''}`, {})
+}
+
+export async function approve(uuid, comment) {
+    return review('approve', uuid, comment)
+}
+
+export async function reject(uuid, comment) {
+    return review('reject', uuid, comment)
+}
+
+async function review(action, uuid, comment) {
+    let url = `/api/reload/${action}?uuid=${uuid}&comment=${encodeURIComponent(comment || '')}`
+    const res = await fetchURL(url, {})
+    if (res.status !== 200) {
+        throw new Error(await res.text())
+    }
+    return res.json()
+}
+
 async function reloadAction(method, content) {
     let opts = { method }
     if (content) {
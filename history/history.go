@@ -0,0 +1,82 @@
+package history
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/reload"
+)
+
+// Action is what was done to an upload session.
+type Action string
+
+const (
+	ActionReload   Action = "reload"
+	ActionRollback Action = "rollback"
+	ActionApprove  Action = "approve"
+	ActionReject   Action = "reject"
+)
+
+// File is a file of an upload session at the time of the action.
+type File struct {
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256"` // empty if the file does not exist
+	Created bool   `json:"created"`
+}
+
+// Entry is a reload, a rollback or a review of an upload session.
+type Entry struct {
+	ID       int              `storm:"id,increment" json:"id"`
+	UUID     string           `storm:"index" json:"uuid"`
+	Action   Action           `json:"action"`
+	UserID   uint             `storm:"index" json:"userID"`
+	Username string           `json:"username"`
+	Time     time.Time        `json:"time"`
+	Files    []File           `json:"files"`
+	BakDirs  []string         `json:"bakDirs"`
+	Proc     string           `json:"proc"`
+	Status   string           `json:"status"`
+	Error    string           `json:"error,omitempty"`
+	Comment  string           `json:"comment,omitempty"` // of the reviewer
+	Results  []*reload.Result `json:"results"`
+}
+
+// Query filters the history. Zero values match everything.
+type Query struct {
+	UserID uint
+	UUID   string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Match checks if the entry matches the query.
+func (q *Query) Match(e *Entry) bool {
+	if q.UserID != 0 && e.UserID != q.UserID {
+		return false
+	}
+	if q.UUID != "" && e.UUID != q.UUID {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseTime parses a time of a query, either RFC 3339 or a local
+// "2006-01-02 15:04:05" or "2006-01-02".
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: %w", s, errors.ErrInvalidRequestParams)
+}
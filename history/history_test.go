@@ -0,0 +1,44 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memBackend []*Entry
+
+func (m memBackend) Get(id int) (*Entry, error) { return m[id-1], nil }
+func (m memBackend) Gets() ([]*Entry, error)    { return m, nil }
+func (m memBackend) Save(e *Entry) error        { return nil }
+
+func TestFind(t *testing.T) {
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local)
+	s := NewStorage(memBackend{
+		{ID: 1, UUID: "a", UserID: 1, Time: day.Add(-time.Hour)},
+		{ID: 2, UUID: "b", UserID: 1, Time: day.Add(time.Hour)},
+		{ID: 3, UUID: "c", UserID: 2, Time: day.Add(2 * time.Hour)},
+		{ID: 4, UUID: "d", UserID: 1, Time: day.Add(25 * time.Hour)},
+	})
+
+	since, err := ParseTime("2026-10-16")
+	require.NoError(t, err)
+	until, err := ParseTime("2026-10-17")
+	require.NoError(t, err)
+
+	entries, err := s.Find(&Query{Since: since, Until: until})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[0].UUID)
+	assert.Equal(t, "b", entries[1].UUID)
+
+	entries, err = s.Find(&Query{UserID: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "d", entries[0].UUID)
+
+	_, err = ParseTime("yesterday")
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package history
+
+import (
+	"sort"
+)
+
+// StorageBackend is the interface to implement for a history storage.
+type StorageBackend interface {
+	Get(id int) (*Entry, error)
+	Gets() ([]*Entry, error)
+	Save(e *Entry) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a history storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// Get wraps a StorageBackend.Get
+func (s *Storage) Get(id int) (*Entry, error) {
+	return s.back.Get(id)
+}
+
+// Find returns the entries matching the query, the latest first.
+func (s *Storage) Find(q *Query) ([]*Entry, error) {
+	entries, err := s.back.Gets()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []*Entry{}
+	for _, e := range entries {
+		if q.Match(e) {
+			found = append(found, e)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].ID > found[j].ID
+	})
+
+	if q.Limit > 0 && len(found) > q.Limit {
+		found = found[:q.Limit]
+	}
+
+	return found, nil
+}
+
+// Save wraps a StorageBackend.Save
+func (s *Storage) Save(e *Entry) error {
+	return s.back.Save(e)
+}
@@ -3,18 +3,24 @@ package http
 import (
 	"bytes"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
 	"time"
 
 	mapset "github.com/deckarep/golang-set"
+
 	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
 )
 
 type CacheData struct {
-	bakdir string
-	xmls   mapset.Set
-	dbs    mapset.Set
-	svrs   mapset.Set
+	bakdir  string
+	files   mapset.Set
+	created mapset.Set
+	xmls    mapset.Set
+	dbs     mapset.Set
+	svrs    mapset.Set
 }
 
 type ConfigType int
@@ -27,22 +33,30 @@ const (
 
 func newCacheData() *CacheData {
 	c := CacheData{
-		bakdir: "",
-		xmls:   mapset.NewSet(),
-		dbs:    mapset.NewSet(),
-		svrs:   mapset.NewSet(),
+		bakdir:  "",
+		files:   mapset.NewSet(),
+		created: mapset.NewSet(),
+		xmls:    mapset.NewSet(),
+		dbs:     mapset.NewSet(),
+		svrs:    mapset.NewSet(),
 	}
 	return &c
 }
 
 // only for debug
 func (c *CacheData) String() string {
-	return fmt.Sprintf("{ bakdir:%s, xml_config:%v, dbs_config:%v, svr_config:%v }", c.bakdir, c.xmls, c.dbs, c.svrs)
+	return fmt.Sprintf("{ bakdir:%s, files:%v, created:%v, xml_config:%v, dbs_config:%v, svr_config:%v }",
+		c.bakdir, c.files, c.created, c.xmls, c.dbs, c.svrs)
 }
 
 type val struct {
 	data        map[string]*CacheData
+	user        uint
+	state       session.State
+	start       int64
 	expiredTime int64
+	canary      *session.Canary
+	approved    map[string]string
 }
 
 type ExpiredMap struct {
@@ -51,6 +65,8 @@ type ExpiredMap struct {
 	timeMap map[int64][]string
 	mtx     *sync.Mutex
 	stop    chan struct{}
+	store   *session.Storage
+	expired func(*session.Session)
 }
 
 func NewExpiredMap(c int) *ExpiredMap {
@@ -85,7 +101,10 @@ func (e *ExpiredMap) run(now int64) {
 		select {
 		case <-t.C:
 			now++
-			if keys, found := e.timeMap[now]; found {
+			e.mtx.Lock()
+			keys, found := e.timeMap[now]
+			e.mtx.Unlock()
+			if found {
 				delCh <- &delMsg{keys: keys, t: now}
 			}
 		case <-e.stop:
@@ -95,7 +114,7 @@ func (e *ExpiredMap) run(now int64) {
 	}
 }
 
-func (e *ExpiredMap) Set(key string, value map[string]*CacheData, ttl int64) bool {
+func (e *ExpiredMap) Set(key string, user uint, value map[string]*CacheData, ttl int64) bool {
 	if ttl <= 0 {
 		return false
 	}
@@ -107,9 +126,13 @@ func (e *ExpiredMap) Set(key string, value map[string]*CacheData, ttl int64) boo
 	expiredTime := time.Now().Unix() + ttl
 	e.m[key] = &val{
 		data:        value,
+		user:        user,
+		state:       session.StateOpen,
+		start:       time.Now().UnixNano(),
 		expiredTime: expiredTime,
 	}
 	e.timeMap[expiredTime] = append(e.timeMap[expiredTime], key)
+	e.persist(key)
 	return true
 }
 
@@ -126,6 +149,7 @@ func (e *ExpiredMap) Get(key string) (found bool, value map[string]*CacheData) {
 func (e *ExpiredMap) Del(key string) {
 	e.mtx.Lock()
 	delete(e.m, key)
+	e.forget(key)
 	e.mtx.Unlock()
 }
 
@@ -134,7 +158,12 @@ func (e *ExpiredMap) MDel(keys []string, t int64) {
 	defer e.mtx.Unlock()
 	delete(e.timeMap, t)
 	for _, key := range keys {
-		delete(e.m, key)
+		// the key may have been renewed or restored with another expiration
+		v, found := e.m[key]
+		if !found || v.expiredTime > t {
+			continue
+		}
+		e.expire(key)
 	}
 }
 
@@ -153,16 +182,82 @@ func (e *ExpiredMap) TTL(key string) int64 {
 	return e.m[key].expiredTime - time.Now().Unix()
 }
 
+// Renew postpones the expiration of the key by ttl seconds from now.
+func (e *ExpiredMap) Renew(key string, ttl int64) bool {
+	if ttl <= 0 {
+		return false
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !e.isKeyExisted(key) {
+		return false
+	}
+	expiredTime := time.Now().Unix() + ttl
+	e.m[key].expiredTime = expiredTime
+	e.timeMap[expiredTime] = append(e.timeMap[expiredTime], key)
+	e.persist(key)
+	return true
+}
+
+func (e *ExpiredMap) GetState(key string) session.State {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !e.isKeyExisted(key) {
+		return ""
+	}
+	return e.m[key].state
+}
+
+func (e *ExpiredMap) SetState(key string, state session.State) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !e.isKeyExisted(key) {
+		return false
+	}
+	e.m[key].state = state
+	e.persist(key)
+	return true
+}
+
+// SetCanary records the canary of a session waiting for promotion, nil
+// once it is promoted or aborted.
+func (e *ExpiredMap) SetCanary(key string, canary *session.Canary) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !e.isKeyExisted(key) {
+		return false
+	}
+	e.m[key].canary = canary
+	e.persist(key)
+	return true
+}
+
+// SetApproved records the checksums of the files approved by the review
+// of a session, nil once it is rejected.
+func (e *ExpiredMap) SetApproved(key string, approved map[string]string) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !e.isKeyExisted(key) {
+		return false
+	}
+	e.m[key].approved = approved
+	e.persist(key)
+	return true
+}
+
 func (e *ExpiredMap) Clear() {
 	e.mtx.Lock()
 	defer e.mtx.Unlock()
+	for key := range e.m {
+		e.forget(key)
+	}
 	e.m = make(map[string]*val)
 	e.timeMap = make(map[int64][]string)
 }
 
+// Close stops the expiration, it is not locked as the expiration takes
+// the lock until it stops.
 func (e *ExpiredMap) Close() {
-	e.mtx.Lock()
-	defer e.mtx.Unlock()
 	e.stop <- struct{}{}
 }
 
@@ -196,6 +291,7 @@ func (e *ExpiredMap) SetCacheData(key string, dir string, c *CacheData) bool {
 		return false
 	}
 	value.data[dir] = c
+	e.persist(key)
 	return true
 }
 
@@ -218,6 +314,7 @@ func (e *ExpiredMap) SetBakDir(key string, dir string, bak string) bool {
 		return false
 	}
 	cd.bakdir = bak
+	e.persist(key)
 	return true
 }
 
@@ -265,6 +362,7 @@ func (e *ExpiredMap) AddConfig(key string, dir string, cfg string, t ConfigType)
 	default:
 		return libErrors.ErrCacheFailed
 	}
+	e.persist(key)
 	return nil
 }
 
@@ -298,15 +396,151 @@ func (e *ExpiredMap) RemoveConfig(key string, dir string, cfg string, t ConfigTy
 	default:
 		return libErrors.ErrCacheFailed
 	}
+	e.persist(key)
+	return nil
+}
+
+// ClaimFile registers the file as being modified by the session. If another
+// live session has already claimed the same file, its key is returned and
+// nothing is registered.
+func (e *ExpiredMap) ClaimFile(key string, dir string, file string) (string, error) {
+	if key == "" || dir == "" || file == "" {
+		return "", libErrors.ErrCacheFailed
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if k := e.ownerOf(key, file); k != "" {
+		return k, nil
+	}
+	value, found := e.m[key]
+	if !found {
+		return "", libErrors.ErrCacheFailed
+	}
+	cd, found := value.data[dir]
+	if !found || cd == nil {
+		return "", libErrors.ErrCacheFailed
+	}
+	cd.files.Add(file)
+	e.persist(key)
+	return "", nil
+}
+
+// HasFile checks whether the file has already been uploaded in the session.
+func (e *ExpiredMap) HasFile(key string, dir string, file string) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	value, found := e.m[key]
+	if !found {
+		return false
+	}
+	cd, found := value.data[dir]
+	return found && cd != nil && cd.files.Contains(file)
+}
+
+// IsCreated checks if the file did not exist before the session.
+func (e *ExpiredMap) IsCreated(key string, dir string, file string) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	value, found := e.m[key]
+	if !found {
+		return false
+	}
+	cd, found := value.data[dir]
+	return found && cd != nil && cd.created.Contains(file)
+}
+
+// AddCreated records that the file did not exist before the session, so
+// rolling back the session deletes it.
+func (e *ExpiredMap) AddCreated(key string, dir string, file string) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	value, found := e.m[key]
+	if !found {
+		return libErrors.ErrCacheFailed
+	}
+	cd, found := value.data[dir]
+	if !found || cd == nil {
+		return libErrors.ErrCacheFailed
+	}
+	cd.created.Add(file)
+	e.persist(key)
 	return nil
 }
 
+// Conflict returns the key of another session which modifies one of the
+// files of the session, if any: a session not reloaded yet, or one opened
+// after it whose changes restoring the files would revert.
+func (e *ExpiredMap) Conflict(key string) string {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	value, found := e.m[key]
+	if !found {
+		return ""
+	}
+	for _, cd := range value.data {
+		if cd == nil {
+			continue
+		}
+		for _, file := range cd.files.ToSlice() {
+			for k, v := range e.m {
+				if k == key || !e.isKeyExisted(k) {
+					continue
+				}
+				if v.state == session.StateReloaded && v.start < value.start {
+					continue
+				}
+				if v.hasFile(file.(string)) {
+					return k
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Not locked, only for internal use
+func (e *ExpiredMap) ownerOf(key string, file string) string {
+	for k, v := range e.m {
+		if k == key || !e.isKeyExisted(k) || v.state == session.StateReloaded {
+			continue
+		}
+		if v.hasFile(file) {
+			return k
+		}
+	}
+	return ""
+}
+
+func (v *val) hasFile(file string) bool {
+	for _, cd := range v.data {
+		if cd != nil && cd.files.Contains(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleaseFile drops the claim of the session on the file.
+func (e *ExpiredMap) ReleaseFile(key string, dir string, file string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	value, found := e.m[key]
+	if !found {
+		return
+	}
+	if cd, found := value.data[dir]; found && cd != nil {
+		cd.files.Remove(file)
+		cd.created.Remove(file)
+		e.persist(key)
+	}
+}
+
 // Not locked, only for internal use
 func (e *ExpiredMap) isKeyExisted(key string) bool {
 	if val, found := e.m[key]; found {
 		if val.expiredTime <= time.Now().Unix() {
-			delete(e.m, key)
 			delete(e.timeMap, val.expiredTime)
+			e.expire(key)
 			return false
 		}
 		return true
@@ -320,8 +554,8 @@ func (e *ExpiredMap) IsKeyExisted(key string) bool {
 	defer e.mtx.Unlock()
 	if val, found := e.m[key]; found {
 		if val.expiredTime <= time.Now().Unix() {
-			delete(e.m, key)
 			delete(e.timeMap, val.expiredTime)
+			e.expire(key)
 			return false
 		}
 		return true
@@ -329,6 +563,178 @@ func (e *ExpiredMap) IsKeyExisted(key string) bool {
 	return false
 }
 
+// Not locked, only for internal use
+func (e *ExpiredMap) expire(key string) {
+	if e.expired != nil {
+		go e.expired(e.toSession(key))
+	}
+	delete(e.m, key)
+	e.forget(key)
+}
+
+// OnExpire sets fn to be called with each session which expires, to clean
+// up what it leaves behind. It is not called for the deleted sessions.
+func (e *ExpiredMap) OnExpire(fn func(*session.Session)) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.expired = fn
+}
+
+// Restore loads the sessions saved in the store and keeps the store
+// up to date with every later change of the cache.
+func (e *ExpiredMap) Restore(store *session.Storage) error {
+	sessions, err := store.Gets()
+	if err != nil {
+		return err
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.store = store
+	for _, sess := range sessions {
+		if _, found := e.m[sess.UUID]; found {
+			continue
+		}
+		data := make(map[string]*CacheData)
+		for dir, d := range sess.Dirs {
+			data[dir] = fromSessionDir(d)
+		}
+		state := sess.State
+		if state == "" {
+			state = session.StateOpen
+		}
+		e.m[sess.UUID] = &val{
+			data:        data,
+			user:        sess.UserID,
+			state:       state,
+			start:       sess.Start,
+			expiredTime: sess.Expire,
+			canary:      sess.Canary,
+			approved:    sess.Approved,
+		}
+		// a session which expired while the server was down is over
+		if sess.Expire <= time.Now().Unix() {
+			e.expire(sess.UUID)
+			log.Printf("upload session %s of user %d expired", sess.UUID, sess.UserID)
+			continue
+		}
+		e.timeMap[sess.Expire] = append(e.timeMap[sess.Expire], sess.UUID)
+		log.Printf("restored upload session %s of user %d", sess.UUID, sess.UserID)
+	}
+	return nil
+}
+
+// Session returns a snapshot of a live session.
+func (e *ExpiredMap) Session(key string) (*session.Session, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !e.isKeyExisted(key) {
+		return nil, false
+	}
+	return e.toSession(key), true
+}
+
+// Sessions returns a snapshot of all live sessions.
+func (e *ExpiredMap) Sessions() []*session.Session {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	var res []*session.Session
+	for key := range e.m {
+		if !e.isKeyExisted(key) {
+			continue
+		}
+		res = append(res, e.toSession(key))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Expire < res[j].Expire
+	})
+	return res
+}
+
+// Not locked, only for internal use
+func (e *ExpiredMap) toSession(key string) *session.Session {
+	v := e.m[key]
+	sess := &session.Session{
+		UUID:     key,
+		UserID:   v.user,
+		State:    v.state,
+		Start:    v.start,
+		Expire:   v.expiredTime,
+		Dirs:     make(map[string]*session.Dir),
+		Canary:   v.canary,
+		Approved: v.approved,
+	}
+	for dir, cd := range v.data {
+		if cd == nil {
+			continue
+		}
+		sess.Dirs[dir] = &session.Dir{
+			BakDir:  cd.bakdir,
+			Files:   setToSortedSlice(cd.files),
+			Created: setToSortedSlice(cd.created),
+			XMLs:    setToSortedSlice(cd.xmls),
+			DBs:     setToSortedSlice(cd.dbs),
+			Svrs:    setToSortedSlice(cd.svrs),
+		}
+	}
+	return sess
+}
+
+// Not locked, only for internal use
+func (e *ExpiredMap) persist(key string) {
+	if e.store == nil {
+		return
+	}
+	if _, found := e.m[key]; !found {
+		return
+	}
+	if err := e.store.Save(e.toSession(key)); err != nil {
+		log.Printf("save upload session %s failed: %v", key, err)
+	}
+}
+
+// Not locked, only for internal use
+func (e *ExpiredMap) forget(key string) {
+	if e.store == nil {
+		return
+	}
+	if err := e.store.Delete(key); err != nil {
+		log.Printf("delete upload session %s failed: %v", key, err)
+	}
+}
+
+func fromSessionDir(d *session.Dir) *CacheData {
+	cd := newCacheData()
+	if d == nil {
+		return cd
+	}
+	cd.bakdir = d.BakDir
+	for _, f := range d.Files {
+		cd.files.Add(f)
+	}
+	for _, f := range d.Created {
+		cd.created.Add(f)
+	}
+	for _, f := range d.XMLs {
+		cd.xmls.Add(f)
+	}
+	for _, f := range d.DBs {
+		cd.dbs.Add(f)
+	}
+	for _, f := range d.Svrs {
+		cd.svrs.Add(f)
+	}
+	return cd
+}
+
+func setToSortedSlice(set mapset.Set) []string {
+	if set == nil {
+		return []string{}
+	}
+	strs := interSliceToStrSlice(set.ToSlice())
+	sort.Strings(strs)
+	return strs
+}
+
 // only for debug
 func (e *ExpiredMap) String() string {
 	e.mtx.Lock()
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+type memSessions map[string]*session.Session
+
+func (m memSessions) Get(uuid string) (*session.Session, error) {
+	if sess, ok := m[uuid]; ok {
+		return sess, nil
+	}
+	return nil, libErrors.ErrNotExist
+}
+
+func (m memSessions) Gets() ([]*session.Session, error) {
+	sessions := make([]*session.Session, 0, len(m))
+	for _, sess := range m {
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+func (m memSessions) Save(sess *session.Session) error {
+	m[sess.UUID] = sess
+	return nil
+}
+
+func (m memSessions) Delete(uuid string) error {
+	delete(m, uuid)
+	return nil
+}
+
+func newTestMap(t *testing.T, store *session.Storage) *ExpiredMap {
+	e := NewExpiredMap(4)
+	t.Cleanup(e.Close)
+	require.NoError(t, e.Restore(store))
+	return e
+}
+
+func TestExpiredMapRestore(t *testing.T) {
+	back := memSessions{}
+	store := session.NewStorage(back)
+
+	e := newTestMap(t, store)
+	require.True(t, e.Set("a", 1, map[string]*CacheData{}, duration))
+	require.True(t, e.SetCacheData("a", "/srv/ClientConfig", newCacheData()))
+	_, err := e.ClaimFile("a", "/srv/ClientConfig", "/srv/ClientConfig/item.db")
+	require.NoError(t, err)
+	require.NoError(t, e.AddConfig("a", "/srv/ClientConfig", "/srv/ClientConfig/item.db", ConfigDB))
+	require.True(t, e.SetBakDir("a", "/srv/ClientConfig", "/ClientConfig_a_20261017_100000"))
+	require.True(t, e.SetState("a", session.StateCanary))
+	require.True(t, e.SetCanary("a", &session.Canary{Inst: "1", Promote: 1700000000}))
+	require.True(t, e.Set("b", 2, map[string]*CacheData{}, duration))
+	e.Del("b")
+
+	// every change is saved, the deleted sessions are forgotten
+	require.Len(t, back, 1)
+	saved := back["a"]
+	assert.Equal(t, session.StateCanary, saved.State)
+	assert.Equal(t, []string{"/srv/ClientConfig/item.db"}, saved.Dirs["/srv/ClientConfig"].DBs)
+
+	// a restarted server resumes the session where it was
+	restored := newTestMap(t, store)
+	sess, found := restored.Session("a")
+	require.True(t, found)
+	assert.Equal(t, uint(1), sess.UserID)
+	assert.Equal(t, session.StateCanary, sess.State)
+	assert.Equal(t, &session.Canary{Inst: "1", Promote: 1700000000}, sess.Canary)
+	assert.Equal(t, saved.Expire, sess.Expire)
+	assert.Equal(t, "/ClientConfig_a_20261017_100000", restored.GetBakDir("a", "/srv/ClientConfig"))
+	assert.True(t, restored.HasFile("a", "/srv/ClientConfig", "/srv/ClientConfig/item.db"))
+	_, found = restored.Session("b")
+	assert.False(t, found)
+
+	// the expired sessions are not restored, they expire at once
+	back["c"] = &session.Session{UUID: "c", UserID: 1, Expire: 1}
+	restored = NewExpiredMap(4)
+	t.Cleanup(restored.Close)
+	expired := make(chan *session.Session, 1)
+	restored.OnExpire(func(sess *session.Session) { expired <- sess })
+	require.NoError(t, restored.Restore(store))
+	assert.NotContains(t, back, "c")
+	assert.Equal(t, 1, restored.Size())
+	select {
+	case sess := <-expired:
+		assert.Equal(t, "c", sess.UUID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session did not expire")
+	}
+}
+
+func TestExpiredMapConflict(t *testing.T) {
+	const dir, file = "/srv/ClientConfig", "/srv/ClientConfig/item.db"
+	tests := []struct {
+		name     string
+		state    session.State // of the session opened first
+		claim    bool          // whether the second session can claim the file then
+		rollback string        // the session rolled back
+		owner    string        // the session conflicting with the rollback
+	}{
+		{"open", session.StateOpen, false, "first", ""},
+		{"pending", session.StatePending, false, "first", ""},
+		{"canary", session.StateCanary, false, "first", ""},
+		{"reloaded then changed", session.StateReloaded, true, "first", "second"},
+		{"rollback of the later session", session.StateReloaded, true, "second", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestMap(t, session.NewStorage(memSessions{}))
+			for _, key := range []string{"first", "second"} {
+				require.True(t, e.Set(key, 1, map[string]*CacheData{}, duration))
+				require.True(t, e.SetCacheData(key, dir, newCacheData()))
+			}
+			owner, err := e.ClaimFile("first", dir, file)
+			require.NoError(t, err)
+			require.Empty(t, owner)
+			require.True(t, e.SetState("first", tt.state))
+
+			owner, err = e.ClaimFile("second", dir, file)
+			require.NoError(t, err)
+			if tt.claim {
+				assert.Empty(t, owner)
+				require.True(t, e.SetState("second", session.StateReloaded))
+			} else {
+				assert.Equal(t, "first", owner)
+			}
+			assert.Equal(t, tt.owner, e.Conflict(tt.rollback))
+		})
+	}
+}
+
+func TestExpiredMapOnExpire(t *testing.T) {
+	e := newTestMap(t, session.NewStorage(memSessions{}))
+	expired := make(chan *session.Session, 2)
+	e.OnExpire(func(sess *session.Session) { expired <- sess })
+
+	require.True(t, e.Set("a", 1, map[string]*CacheData{}, 1))
+	require.True(t, e.Set("b", 2, map[string]*CacheData{}, 1))
+	// a deleted session is not expired
+	e.Del("b")
+
+	select {
+	case sess := <-expired:
+		assert.Equal(t, "a", sess.UUID)
+		assert.Equal(t, uint(1), sess.UserID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session did not expire")
+	}
+	assert.False(t, e.IsKeyExisted("a"))
+	assert.Empty(t, expired)
+}
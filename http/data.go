@@ -26,6 +26,10 @@ type data struct {
 
 // Check implements rules.Checker.
 func (d *data) Check(path string) bool {
+	if inStaging(path) {
+		return false
+	}
+
 	allow := true
 	for _, rule := range d.settings.Rules {
 		if rule.Matches(path) {
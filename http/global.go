@@ -7,5 +7,10 @@ import (
 var mtx sync.Mutex
 
 const duration int64 = 60 * 60 // valid period: 1 hour
-const cap int = 1              // capacity
+const cap int = 64             // capacity: maximum number of concurrent upload sessions
 var cache = NewExpiredMap(cap) // cache data
+
+const reloadQueueCap int = 64                // capacity: maximum number of pending reloads
+var reloads = newReloadQueue(reloadQueueCap) // reloads are executed one at a time
+
+const reviewDuration int64 = 24 * 60 * 60 // valid period of a session waiting for review: 1 day
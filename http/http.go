@@ -5,6 +5,7 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/filebrowser/filebrowser/v2/session"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/storage"
 )
@@ -17,6 +18,18 @@ type modifyRequest struct {
 func NewHandler(imgSvc ImgService, fileCache FileCache, store *storage.Storage, server *settings.Server) (http.Handler, error) {
 	server.Clean()
 
+	// the staged files of the sessions which expire are never committed
+	cache.OnExpire(func(sess *session.Session) {
+		dropStaging(store, server, sess)
+	})
+	// resume the upload sessions interrupted by a restart
+	if err := cache.Restore(store.Sessions); err != nil {
+		return nil, err
+	}
+	if err := restoreCanaries(store, server); err != nil {
+		return nil, err
+	}
+
 	r := mux.NewRouter()
 	index, static := getStaticHandlers(store, server)
 
@@ -37,6 +50,7 @@ func NewHandler(imgSvc ImgService, fileCache FileCache, store *storage.Storage,
 	api.Handle("/login", monkey(loginHandler, ""))
 	api.Handle("/signup", monkey(signupHandler, ""))
 	api.Handle("/renew", monkey(renewHandler, ""))
+	api.Handle("/version", monkey(versionHandler, "")).Methods("GET")
 
 	users := api.PathPrefix("/users").Subrouter()
 	users.Handle("", monkey(usersGetHandler, "")).Methods("GET")
@@ -51,6 +65,9 @@ func NewHandler(imgSvc ImgService, fileCache FileCache, store *storage.Storage,
 	api.PathPrefix("/resources").Handler(monkey(resourcePostPutHandler, "/api/resources")).Methods("PUT")
 	api.PathPrefix("/resources").Handler(monkey(resourcePatchHandler, "/api/resources")).Methods("PATCH")
 
+	api.PathPrefix("/chunks").Handler(monkey(chunkHeadHandler, "/api/chunks")).Methods("HEAD")
+	api.PathPrefix("/chunks").Handler(monkey(chunkPatchHandler, "/api/chunks")).Methods("PATCH")
+
 	api.PathPrefix("/share").Handler(monkey(shareGetsHandler, "/api/share")).Methods("GET")
 	api.PathPrefix("/share").Handler(monkey(sharePostHandler, "/api/share")).Methods("POST")
 	api.PathPrefix("/share").Handler(monkey(shareDeleteHandler, "/api/share")).Methods("DELETE")
@@ -64,7 +81,19 @@ func NewHandler(imgSvc ImgService, fileCache FileCache, store *storage.Storage,
 	api.PathPrefix("/command").Handler(monkey(commandsHandler, "/api/command")).Methods("GET")
 	api.PathPrefix("/search").Handler(monkey(searchHandler, "/api/search")).Methods("GET")
 
-	api.PathPrefix("/reload").Handler(monkey(reloadHandler, "/api/reload")).Methods("GET")
+	reload := api.PathPrefix("/reload").Subrouter()
+	reload.Handle("", monkey(reloadHandler, "")).Methods("GET")
+	reload.Handle("/stream", monkey(reloadStreamHandler, "")).Methods("GET")
+	reload.Handle("/sessions", monkey(sessionsGetHandler, "")).Methods("GET")
+	reload.Handle("/rollback", monkey(reloadRollbackHandler, "")).Methods("GET")
+	reload.Handle("/promote", monkey(reloadPromoteHandler, "")).Methods("GET")
+	reload.Handle("/abort", monkey(reloadAbortHandler, "")).Methods("GET")
+	reload.Handle("/commit", monkey(reloadCommitHandler, "")).Methods("GET")
+	reload.Handle("/plan", monkey(reloadPlanHandler, "")).Methods("GET")
+	reload.Handle("/diff", monkey(reloadDiffHandler, "")).Methods("GET")
+	reload.Handle("/approve", monkey(reloadApproveHandler, "")).Methods("GET")
+	reload.Handle("/reject", monkey(reloadRejectHandler, "")).Methods("GET")
+	reload.Handle("/history", monkey(reloadHistoryGetHandler, "")).Methods("GET")
 
 	public := api.PathPrefix("/public").Subrouter()
 	public.PathPrefix("/dl").Handler(monkey(publicDlHandler, "/api/public/dl/")).Methods("GET")
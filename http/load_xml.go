@@ -2,9 +2,13 @@ package http
 
 import (
 	"encoding/xml"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"path"
+	"path/filepath"
 	"strings"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
 )
 
 type XMLExcelCfg struct {
@@ -12,10 +16,26 @@ type XMLExcelCfg struct {
 	ExcelName string   `xml:"name,attr"`
 }
 
+// XMLFileCfg is a ClientConfig xml loaded by a server, name is matched
+// against the file name and may be a glob such as "GameSvr*.xml".
+type XMLFileCfg struct {
+	XMLName  xml.Name `xml:"xml"`
+	FileName string   `xml:"name,attr"`
+}
+
+// XMLSvrConfigCfg is a ServerConfig file or directory loaded by a server,
+// path is relative to ServerConfig and may be a glob such as "GameSvr/*.conf".
+type XMLSvrConfigCfg struct {
+	XMLName xml.Name `xml:"svrconfig"`
+	Path    string   `xml:"path,attr"`
+}
+
 type XMLSvrCfg struct {
-	XMLName   xml.Name      `xml:"server"`
-	SvrName   string        `xml:"name,attr"`
-	ExcelList []XMLExcelCfg `xml:"excel"`
+	XMLName       xml.Name          `xml:"server"`
+	SvrName       string            `xml:"name,attr"`
+	ExcelList     []XMLExcelCfg     `xml:"excel"`
+	XMLList       []XMLFileCfg      `xml:"xml"`
+	SvrConfigList []XMLSvrConfigCfg `xml:"svrconfig"`
 }
 
 type XMLSvrLoadResult struct {
@@ -24,32 +44,83 @@ type XMLSvrLoadResult struct {
 }
 
 type SvrLoadCfg struct {
-	SvrName  string
-	LoadList []string
+	SvrName       string
+	LoadList      []string
+	XMLList       []string
+	SvrConfigList []string
+}
+
+// svrLoadRule maps the files matching pattern to the procs loading them.
+type svrLoadRule struct {
+	Pattern string
+	Procs   []string
 }
 
-var svrNameToIDMap = map[string]string{
-	"Common":         "*.*.*.*",
-	"GameSvr":        "*.*.13.*",
-	"MatchSvr":       "*.*.17.*",
-	"PvpAgentSvr":    "*.*.16.*",
-	"ChatSvr":        "*.*.20.*",
-	"ViewSvr":        "*.*.34.*",
-	"TeamSvr":        "*.*.19.*",
-	"ActivitySvr":    "*.*.39.*",
-	"WeeklyFubenSvr": "*.*.40.*"}
-
-// Parse which server the db file belongs to
-func parseSvrloadXML(xmlFile string) map[string][]string {
+// svrLoadList tells which procs load the configs, according to
+// SvrLoadList.xml.
+type svrLoadList struct {
+	DBs  map[string][]string // by db name
+	XMLs []*svrLoadRule      // ClientConfig xml file names
+	Svrs []*svrLoadRule      // paths relative to ServerConfig
+}
+
+// xmlProcs returns the procs loading the ClientConfig xml file, nil if no
+// server declares it.
+func (l *svrLoadList) xmlProcs(file string) []string {
+	name := filepath.Base(file)
+	return matchProcs(l.XMLs, func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
+
+// svrProcs returns the procs loading the ServerConfig file, nil if no
+// server declares it or one of its directories.
+func (l *svrLoadList) svrProcs(file string) []string {
+	// the path is relative to the user root, which may be ServerConfig's parent
+	file = "/" + filepath.ToSlash(file)
+	i := strings.Index(file, "/ServerConfig/")
+	if i < 0 {
+		return nil
+	}
+	rel := file[i+len("/ServerConfig/"):]
+	return matchProcs(l.Svrs, func(pattern string) bool {
+		for p := rel; p != "."; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func matchProcs(rules []*svrLoadRule, match func(pattern string) bool) []string {
+	var procs []string
+	for _, rule := range rules {
+		if !match(rule.Pattern) {
+			continue
+		}
+		// not nil once matched, even by skipped servers only
+		if procs == nil {
+			procs = []string{}
+		}
+		procs = append(procs, rule.Procs...)
+	}
+	return procs
+}
+
+// Parse which server the db, xml and ServerConfig files belong to, the
+// server names are mapped to proc IDs with procMap.
+func parseSvrLoadList(xmlFile string, procMap map[string]string) (*svrLoadList, error) {
 	content, err := ioutil.ReadFile(xmlFile)
 	if err != nil {
-		log.Println(err.Error())
+		return nil, err
 	}
 
 	var result XMLSvrLoadResult
 	err = xml.Unmarshal(content, &result)
 	if err != nil {
-		log.Println(err.Error())
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(xmlFile), err)
 	}
 
 	var loadCfg []SvrLoadCfg
@@ -60,18 +131,46 @@ func parseSvrloadXML(xmlFile string) map[string][]string {
 		for _, excelCfg := range serverCfg.ExcelList {
 			svrLoadCfg.LoadList = append(svrLoadCfg.LoadList, strings.Title(excelCfg.ExcelName))
 		}
+		for _, xmlCfg := range serverCfg.XMLList {
+			if _, err := path.Match(xmlCfg.FileName, ""); err != nil {
+				return nil, fmt.Errorf("xml %q of server %s in %s is invalid: %w",
+					xmlCfg.FileName, serverCfg.SvrName, filepath.Base(xmlFile), libErrors.ErrInvalidRequestParams)
+			}
+			svrLoadCfg.XMLList = append(svrLoadCfg.XMLList, xmlCfg.FileName)
+		}
+		for _, svrCfg := range serverCfg.SvrConfigList {
+			pattern := strings.Trim(path.Clean("/"+svrCfg.Path), "/")
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return nil, fmt.Errorf("svrconfig %q of server %s in %s is invalid: %w",
+					svrCfg.Path, serverCfg.SvrName, filepath.Base(xmlFile), libErrors.ErrInvalidRequestParams)
+			}
+			svrLoadCfg.SvrConfigList = append(svrLoadCfg.SvrConfigList, pattern)
+		}
 		loadCfg = append(loadCfg, svrLoadCfg)
 	}
 
-	res := make(map[string][]string)
+	res := &svrLoadList{DBs: make(map[string][]string)}
 	for _, cfg := range loadCfg {
 		svr := cfg.SvrName
-		if svr == "MonitorSvr" {
-			continue
+		id, ok := procMap[svr]
+		if !ok {
+			return nil, fmt.Errorf("server %s of %s is not mapped to a proc id: %w",
+				svr, filepath.Base(xmlFile), libErrors.ErrInvalidRequestParams)
+		}
+		// explicitly skipped, its files still count as mapped
+		procs := []string{}
+		if id != "" {
+			procs = append(procs, id)
 		}
 		for _, db := range cfg.LoadList {
-			res[db] = append(res[db], svrNameToIDMap[svr])
+			res.DBs[db] = append(res.DBs[db], procs...)
+		}
+		for _, name := range cfg.XMLList {
+			res.XMLs = append(res.XMLs, &svrLoadRule{Pattern: name, Procs: procs})
+		}
+		for _, p := range cfg.SvrConfigList {
+			res.Svrs = append(res.Svrs, &svrLoadRule{Pattern: p, Procs: procs})
 		}
 	}
-	return res
+	return res, nil
 }
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
+
+const testSvrLoadList = `<root>
+	<server name="GameSvr"><excel name="item"/><excel name="skill"/><xml name="GameSvr*.xml"/><svrconfig path="GameSvr"/></server>
+	<server name="MatchSvr"><excel name="item"/><xml name="Match.xml"/><svrconfig path="/common/*.conf"/></server>
+	<server name="MonitorSvr"><excel name="item"/><xml name="Monitor.xml"/></server>
+</root>`
+
+func writeSvrLoadList(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "svrloadlist")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := filepath.Join(dir, "SvrLoadList.xml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+func TestParseSvrloadXML(t *testing.T) {
+	file := writeSvrLoadList(t, testSvrLoadList)
+	procMap := map[string]string{
+		"GameSvr":    "*.*.13.*",
+		"MatchSvr":   "*.*.17.*",
+		"MonitorSvr": "",
+	}
+
+	list, err := parseSvrLoadList(file, procMap)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.*.13.*", "*.*.17.*"}, list.DBs["Item"])
+	assert.Equal(t, []string{"*.*.13.*"}, list.DBs["Skill"])
+
+	assert.Equal(t, []string{"*.*.13.*"}, list.xmlProcs("/wedo/ClientConfig/GameSvrBattle.xml"))
+	assert.Equal(t, []string{"*.*.17.*"}, list.xmlProcs("/wedo/ClientConfig/CSCommon/Match.xml"))
+	assert.Equal(t, []string{}, list.xmlProcs("/wedo/ClientConfig/Monitor.xml"))
+	assert.Nil(t, list.xmlProcs("/wedo/ClientConfig/Other.xml"))
+
+	assert.Equal(t, []string{"*.*.13.*"}, list.svrProcs("/wedo/ServerConfig/GameSvr/sub/a.conf"))
+	assert.Equal(t, []string{"*.*.17.*"}, list.svrProcs("ServerConfig/common/db.conf"))
+	assert.Nil(t, list.svrProcs("/wedo/ServerConfig/common/sub/db.conf"))
+	assert.Nil(t, list.svrProcs("/wedo/ServerConfig/GameSvrX/a.conf"))
+
+	delete(procMap, "MatchSvr")
+	_, err = parseSvrLoadList(file, procMap)
+	assert.True(t, errors.Is(err, libErrors.ErrInvalidRequestParams))
+
+	file = writeSvrLoadList(t, `<root><server name="GameSvr"><xml name="[.xml"/></server></root>`)
+	_, err = parseSvrLoadList(file, procMap)
+	assert.True(t, errors.Is(err, libErrors.ErrInvalidRequestParams))
+}
+
+func TestGetSvrIDsFromSlice(t *testing.T) {
+	assert.Equal(t, "*.*.[13].*", getSvrIDsFromSlice([]string{"*.*.13.*", "*.*.13.*"}))
+	assert.Equal(t, "*.*.*.*", getSvrIDsFromSlice([]string{"*.*.13.*", "*.*.*.*"}))
+}
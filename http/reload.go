@@ -1,21 +1,26 @@
 package http
 
 import (
-    "bufio"
-    "io"
+    "errors"
+    "fmt"
     "log"
     "net/http"
-    "os/exec"
-    "path/filepath"
-    "regexp"
     "strings"
+    "time"
 
     mapset "github.com/deckarep/golang-set"
+
+    libErrors "github.com/filebrowser/filebrowser/v2/errors"
+    "github.com/filebrowser/filebrowser/v2/history"
+    "github.com/filebrowser/filebrowser/v2/reload"
+    "github.com/filebrowser/filebrowser/v2/session"
+    "github.com/filebrowser/filebrowser/v2/settings"
 )
 
 type response struct {
-    Status string   `json:"status"`
-    Msg    []string `json:"msg"`
+    Status  string           `json:"status"`
+    Msg     []string         `json:"msg"`
+    Results []*reload.Result `json:"results,omitempty"`
 }
 
 var reloadHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
@@ -27,52 +32,32 @@ var reloadHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *dat
         return http.StatusForbidden, nil
     }
 
-    xmlFile := filepath.Join(d.user.Scope, "wedo/ClientConfig/CSCommon/DB/SvrLoadList.xml")
-    cfgs := parseSvrloadXML(xmlFile)
-    mtx.Lock()
-    // log.Println(cache)
-    found, vals := cache.Get(uuid)
+    sess, found := cache.Session(uuid)
     if !found {
         w.WriteHeader(http.StatusForbidden)
-        w.Write([]byte("Someone is currently hot reloading, please try again later!\n"))
-        mtx.Unlock()
+        w.Write([]byte("Upload session not found or expired, please upload config again!\n"))
         return http.StatusForbidden, nil
     }
-    var str string
-    var svrs []string
-    for k, v := range vals {
-        log.Println("dir: ", k)
-        if v.svrs != nil && v.svrs.Cardinality() > 0 {
-            str = "*.*.*.*"
-            break
-        }
-
-        if v.xmls != nil && v.xmls.Cardinality() > 0 {
-            str = "*.*.*.*"
-            break
-        }
 
-        if v.dbs != nil && v.dbs.Cardinality() > 0 {
-            dbs := interSliceToStrSlice(v.dbs.ToSlice())
-            for i := 0; i < len(dbs); i++ {
-                dbName := filepath.Base(dbs[i])
-                dbName = strings.TrimRight(dbName, ".db")
-                if arr, ok := cfgs[dbName]; ok {
-                    svrs = append(svrs, arr...)
-                }
-            }
-        }
+    if !d.user.Perm.Admin && sess.UserID != d.user.ID {
+        return http.StatusForbidden, nil
+    }
+    d, err := sessionData(d, sess)
+    if err != nil {
+        return errToStatus(err), err
     }
 
-    if str != "*.*.*.*" {
-        str = getSvrIDsFromSlice(svrs)
-        log.Println("procs", str)
+    canary, err := canaryParams(r)
+    if err != nil {
+        return http.StatusBadRequest, err
     }
 
-    err, out := execReload(d, str)
-    // Command executed, safely clear the cache and unlock
-    cache.Clear()
-    mtx.Unlock()
+    report, err := reloadSession(d, uuid, canary, nil)
+    if report == nil {
+        w.WriteHeader(http.StatusConflict)
+        w.Write([]byte("This session is already waiting for reload\n"))
+        return http.StatusConflict, nil
+    }
 
     w.WriteHeader(errToStatus(err))
 
@@ -82,58 +67,217 @@ var reloadHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *dat
     }
 
     rsp := &response{
-        Status: status,
-        Msg:    out,
+        Status:  status,
+        Msg:     report.Lines,
+        Results: report.Results,
     }
 
     if _, err := renderJSONIndent(w, r, rsp); err != nil {
         return errToStatus(err), err
     }
 
-    return errToStatus(err), err
+    // the status has already been written with the response
+    return 0, err
 })
 
-func execReload(d *data, proc string) (error, []string) {
-    // root: /data/home/user00
-    rootDir := d.user.FullPath("")
-    tcmDir := filepath.Join(rootDir, "apps/tcm/bin")
-    cmd := exec.Command("sh", "console_cmd.sh", "reload "+proc)
-    cmd.Dir = tcmDir
+// reloadSession reloads the servers of the session once the reloads queued
+// before it are over, notifying l of the progress. With a canary, only its
+// instances are reloaded and the session waits for the promotion. The report
+// is nil when the session is already waiting for reload.
+func reloadSession(d *data, uuid string, canary *canaryRun, l reload.Listener) (*reload.Report, error) {
+    var err error
+    var report *reload.Report
+    // Only one reload runs at a time, the others wait in the queue
+    qerr := reloads.Do(uuid, func() {
+        if cache.GetState(uuid) == session.StateCanary {
+            err = libErrors.ErrExist
+            report = &reload.Report{Lines: []string{"The canary of this session is waiting to be promoted or aborted"}}
+            return
+        }
+        if err = checkApproved(d, uuid); err != nil {
+            report = &reload.Report{Lines: []string{"This session must be approved before it is reloaded"}}
+            return
+        }
+
+        // the processes would also load the uploads of the other session
+        if plan, perr := newReloadPlan(d, uuid); perr == nil {
+            if other, id := targetConflict(d, plan); other != "" {
+                err = libErrors.ErrSessionConflict
+                report = &reload.Report{Lines: []string{fmt.Sprintf(
+                    "The session %s, which is not reloaded yet, also reloads %s: reload or roll it back first", other, id)}}
+                return
+            }
+        }
+
+        // the staged files are swapped into place before the reload
+        if out, cerr := commitSession(d, uuid); cerr != nil {
+            err = cerr
+            report = &reload.Report{Lines: append(out, "Commit failed: "+cerr.Error())}
+            return
+        }
+
+        plan, perr := newReloadPlan(d, uuid)
+        if perr == libErrors.ErrNotExist {
+            err = perr
+            report = &reload.Report{Lines: []string{"Upload session expired while waiting for reload"}}
+            return
+        } else if perr != nil {
+            err = perr
+            report = &reload.Report{Lines: []string{perr.Error()}}
+            return
+        }
+
+        waves, proc, inst := plan.Waves, plan.Proc, ""
+        if canary != nil {
+            inst = canary.inst
+            waves = canaryWaves(plan.Waves, inst)
+            if len(waves) == 0 && plan.Proc != "" {
+                err = fmt.Errorf("no process of the session has the instance %s: %w", inst, libErrors.ErrInvalidRequestParams)
+                report = &reload.Report{Lines: []string{err.Error()}}
+                return
+            }
+            proc = wavesProc(waves)
+        }
+
+        log.Println("procs", proc)
+        start := time.Now()
+        var done int
+        report, done, err = execWaves(d, waves, l)
+        recordHistory(d, history.ActionReload, start, uuid, plan.Dirs, proc, report, err)
+
+        // the waves done may run with the new configs, the others did not get them
+        if errors.Is(err, libErrors.ErrReloadFailed) && d.settings.Reload.RollbackEnabled() {
+            rollback(d, uuid, firstWaves(done, inst), report, l)
+            return
+        }
+
+        if canary != nil && err == nil {
+            startCanary(d, uuid, canary, report, l)
+            return
+        }
+
+        // Command executed, keep the session a while for rollback
+        cache.SetState(uuid, session.StateReloaded)
+        cache.Renew(uuid, duration)
+    })
+    if qerr != nil {
+        return nil, qerr
+    }
+    return report, err
+}
+
+// addLine adds a line to the report and notifies l of it.
+func addLine(report *reload.Report, l reload.Listener, line string) {
+    report.Lines = append(report.Lines, line)
+    if l != nil {
+        l(&reload.Event{Type: reload.EventLine, Line: line})
+    }
+}
+
+// execWaves reloads the waves in order, a wave starts once the previous one
+// succeeded and passed the health check. It returns how many waves were
+// started, the last of which failed if err is not nil.
+func execWaves(d *data, waves []*reloadWave, l reload.Listener) (*reload.Report, int, error) {
+    report := &reload.Report{}
+    line := func(s string) {
+        addLine(report, l, s)
+    }
+
+    if len(waves) == 0 {
+        rr, err := execReload(d, "", l)
+        return rr, 0, err
+    }
+
+    for i, wave := range waves {
+        if len(waves) > 1 {
+            line(fmt.Sprintf("Wave %d/%d: %s %s", i+1, len(waves), strings.Join(wave.Servers, ","), wave.Proc))
+        }
+
+        rr, err := execReload(d, wave.Proc, l)
+        report.Lines = append(report.Lines, rr.Lines...)
+        report.Results = append(report.Results, rr.Results...)
+        if err != nil {
+            return report, i + 1, err
+        }
+        if failed := rr.Failed(); len(failed) > 0 {
+            err = fmt.Errorf("wave %d: %d processes failed: %w", i+1, len(failed), libErrors.ErrReloadFailed)
+            line(err.Error())
+            return report, i + 1, err
+        }
 
-    stdout, err := cmd.StdoutPipe()
+        if i == len(waves)-1 || len(d.settings.Reload.HealthCheck) == 0 {
+            continue
+        }
+        hr, err := execHealthCheck(d, wave.Proc, l)
+        report.Lines = append(report.Lines, hr.Lines...)
+        if err == nil && len(hr.Failed()) > 0 {
+            err = errors.New("failed processes")
+        }
+        if err != nil {
+            err = fmt.Errorf("health check of wave %d: %v: %w", i+1, err, libErrors.ErrReloadFailed)
+            line(err.Error())
+            return report, i + 1, err
+        }
+    }
+    return report, len(waves), nil
+}
+
+// execHealthCheck runs the health check of the settings after the reload
+// of proc, in the directory of the backend.
+func execHealthCheck(d *data, proc string, l reload.Listener) (*reload.Report, error) {
+    checker, err := reload.New(settings.ReloadBackend{
+        Type:    settings.ReloadBackendCommand,
+        Dir:     d.settings.Reload.Backend.Dir,
+        Command: d.settings.Reload.HealthCheck,
+        Timeout: d.settings.Reload.Backend.Timeout,
+    }, d.user.FullPath(""))
     if err != nil {
-        log.Printf("Get StdoutPipe failed for %s", err.Error())
-        return err, []string{"Get StdoutPipe failed for " + err.Error()}
+        return &reload.Report{Lines: []string{err.Error()}}, err
+    }
+
+    report, err := checker.Reload(proc, l)
+    if report == nil {
+        report = &reload.Report{}
     }
+    return report, err
+}
 
-    stderr, err := cmd.StderrPipe()
+// rollback restores the files of a session whose reload failed, and
+// reloads the waves selected by waves. Its lines are added to report.
+func rollback(d *data, uuid string, waves rollbackWaves, report *reload.Report, l reload.Listener) {
+    addLine(report, l, "Rolling back the session")
+    rr, err := rollbackSession(d, uuid, waves)
+    for _, s := range rr.Lines {
+        addLine(report, l, s)
+    }
     if err != nil {
-        log.Printf("Get StderrPipe failed for %s", err.Error())
-        return err, []string{"Get StderrPipe failed for " + err.Error()}
+        log.Printf("rollback of session %s failed: %v", uuid, err)
+        addLine(report, l, "Rollback failed: "+err.Error())
+        return
     }
+    addLine(report, l, "Rollback OK")
+}
 
-    if err := cmd.Start(); err != nil {
-        log.Printf("Start command failed for %s", err.Error())
-        return err, []string{"Start command failed for " + err.Error()}
+// execReload reloads the processes matching proc with the backend of the
+// settings, relative directories are resolved against the user root.
+func execReload(d *data, proc string, l reload.Listener) (*reload.Report, error) {
+    if proc == "" {
+        return &reload.Report{Lines: []string{"No process loads the uploaded configs, nothing to reload"}}, nil
     }
 
-    var arr []string
-    s := bufio.NewScanner(io.MultiReader(stdout, stderr))
-    for s.Scan() {
-        // match the strings with failed reloading
-        regstr := "(?i)^.*\\[failed\\]$|(?i)^.*\\[succeed\\]$"
-        line := s.Text()
-        log.Println(line)
-        if match, _ := regexp.MatchString(regstr, line); match {
-            arr = append(arr, strings.TrimSpace(line))
-        }
+    reloader, err := reload.New(d.settings.Reload.Backend, d.user.FullPath(""))
+    if err != nil {
+        return &reload.Report{Lines: []string{err.Error()}}, err
     }
 
-    if err := cmd.Wait(); err != nil {
-        log.Printf("Command execution failed for %s", err.Error())
-        return err, arr
+    report, err := reloader.Reload(proc, l)
+    if report == nil {
+        report = &reload.Report{}
+    }
+    if err != nil && len(report.Lines) == 0 {
+        report.Lines = []string{err.Error()}
     }
-    return nil, arr
+    return report, err
 }
 
 func interSliceToStrSlice(inters []interface{}) []string {
@@ -0,0 +1,297 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/history"
+	"github.com/filebrowser/filebrowser/v2/reload"
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/session"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage"
+)
+
+// canaryRun is the canary of a session: the instance inst of its processes
+// is reloaded first, the others are reloaded when it is promoted, by hand or
+// once watch is over if it is not 0, at promote.
+type canaryRun struct {
+	inst    string
+	watch   time.Duration
+	promote time.Time
+	timer   *time.Timer
+}
+
+// canaryRegistry holds the canaries waiting for promotion. They are also
+// saved with their session, so that they are registered again after a
+// restart and promoted when they were due.
+type canaryRegistry struct {
+	mtx  sync.Mutex
+	runs map[string]*canaryRun
+}
+
+var canaries = &canaryRegistry{runs: map[string]*canaryRun{}}
+
+// add registers the canary of a session, promote is called once its watch
+// is over.
+func (c *canaryRegistry) add(uuid string, run *canaryRun, promote func()) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.runs[uuid] = run
+	if !run.promote.IsZero() {
+		run.timer = time.AfterFunc(time.Until(run.promote), promote)
+	}
+}
+
+// remove unregisters the canary of a session and stops its timer, it
+// returns nil if there is none.
+func (c *canaryRegistry) remove(uuid string) *canaryRun {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	run := c.runs[uuid]
+	delete(c.runs, uuid)
+	if run != nil && run.timer != nil {
+		run.timer.Stop()
+	}
+	return run
+}
+
+var canaryInstRegexp = regexp.MustCompile(`^(\d+|\[\d+(,\d+)*\])$`)
+
+// canaryParams reads the canary of a reload request: the instance to reload
+// first in "canary", such as "1" or "[1,2]", and in "watch" the seconds
+// before the others are reloaded, 0 or none to wait for the promotion. It
+// returns nil without canary.
+func canaryParams(r *http.Request) (*canaryRun, error) {
+	inst := r.URL.Query().Get("canary")
+	if inst == "" {
+		return nil, nil
+	}
+	if !canaryInstRegexp.MatchString(inst) {
+		return nil, fmt.Errorf("invalid canary instance %q: %w", inst, libErrors.ErrInvalidRequestParams)
+	}
+
+	run := &canaryRun{inst: inst}
+	if watch := r.URL.Query().Get("watch"); watch != "" {
+		secs, err := strconv.Atoi(watch)
+		if err != nil || secs < 0 {
+			return nil, fmt.Errorf("invalid canary watch %q: %w", watch, libErrors.ErrInvalidRequestParams)
+		}
+		run.watch = time.Duration(secs) * time.Second
+	}
+	return run, nil
+}
+
+// canaryWaves restricts the waves to the instance inst of their processes.
+// The waves which target specific instances are left to the promotion.
+func canaryWaves(waves []*reloadWave, inst string) []*reloadWave {
+	canary := make([]*reloadWave, 0, len(waves))
+	for _, wave := range waves {
+		parts := strings.Split(wave.Proc, ".")
+		if len(parts) != 4 || parts[3] != "*" { //nolint:mnd
+			continue
+		}
+		parts[3] = inst
+		canary = append(canary, &reloadWave{Servers: wave.Servers, Proc: strings.Join(parts, ".")})
+	}
+	return canary
+}
+
+// startCanary makes the session wait for the promotion of its canary, which
+// has been reloaded.
+func startCanary(d *data, uuid string, run *canaryRun, report *reload.Report, l reload.Listener) {
+	cache.SetState(uuid, session.StateCanary)
+	// the session must outlive the watch to be promoted or rolled back
+	cache.Renew(uuid, duration+int64(run.watch/time.Second))
+
+	canary := &session.Canary{Inst: run.inst}
+	if run.watch > 0 {
+		run.promote = time.Now().Add(run.watch)
+		canary.Promote = run.promote.Unix()
+	}
+	cache.SetCanary(uuid, canary)
+	armCanary(d, uuid, run)
+
+	if run.watch > 0 {
+		addLine(report, l, fmt.Sprintf("Canary reloaded, the other instances are reloaded in %s unless it is aborted", run.watch))
+	} else {
+		addLine(report, l, "Canary reloaded, promote it to reload the other instances or abort it")
+	}
+}
+
+// armCanary registers the canary of a session, which the user of d
+// promotes once it is due.
+func armCanary(d *data, uuid string, run *canaryRun) {
+	canaries.add(uuid, run, func() {
+		if _, err := promoteCanary(d, uuid, nil); err != nil {
+			log.Printf("promote the canary of session %s failed: %v", uuid, err)
+		}
+	})
+}
+
+// restoreCanaries registers again the canaries of the sessions restored
+// after a restart. Those due while the server was down are promoted now.
+func restoreCanaries(store *storage.Storage, server *settings.Server) error {
+	for _, sess := range cache.Sessions() {
+		if sess.State != session.StateCanary || sess.Canary == nil {
+			continue
+		}
+		set, err := store.Settings.Get()
+		if err != nil {
+			return err
+		}
+		user, err := store.Users.Get(server.Root, sess.UserID)
+		if err != nil {
+			log.Printf("restore the canary of session %s failed: %v", sess.UUID, err)
+			continue
+		}
+
+		run := &canaryRun{inst: sess.Canary.Inst}
+		if sess.Canary.Promote != 0 {
+			run.promote = time.Unix(sess.Canary.Promote, 0)
+		}
+		d := &data{Runner: &runner.Runner{Settings: set}, settings: set, server: server, store: store, user: user}
+		armCanary(d, sess.UUID, run)
+		log.Printf("restored the canary %s of session %s", run.inst, sess.UUID)
+	}
+	return nil
+}
+
+// promoteCanary reloads all the processes of a session whose canary is
+// waiting for promotion. The canary instances are reloaded again with the
+// others, the reload expressions can't exclude them.
+func promoteCanary(d *data, uuid string, l reload.Listener) (*reload.Report, error) {
+	var err error
+	var report *reload.Report
+	qerr := reloads.Do(uuid, func() {
+		if cache.GetState(uuid) != session.StateCanary {
+			err = libErrors.ErrNotExist
+			report = &reload.Report{Lines: []string{"No canary of this session is waiting for promotion"}}
+			return
+		}
+		canaries.remove(uuid)
+		cache.SetCanary(uuid, nil)
+
+		plan, perr := newReloadPlan(d, uuid)
+		if perr != nil {
+			err = perr
+			report = &reload.Report{Lines: []string{perr.Error()}}
+			return
+		}
+
+		log.Println("procs", plan.Proc)
+		start := time.Now()
+		report, _, err = execWaves(d, plan.Waves, l)
+		recordHistory(d, history.ActionReload, start, uuid, plan.Dirs, plan.Proc, report, err)
+
+		// the canary instances of the waves not done have the new configs too
+		if errors.Is(err, libErrors.ErrReloadFailed) && d.settings.Reload.RollbackEnabled() {
+			rollback(d, uuid, allWaves, report, l)
+			return
+		}
+
+		cache.SetState(uuid, session.StateReloaded)
+		cache.Renew(uuid, duration)
+	})
+	if qerr != nil {
+		return nil, qerr
+	}
+	return report, err
+}
+
+// abortCanary restores the files of a session whose canary is waiting for
+// promotion, and reloads the canary instances.
+func abortCanary(d *data, uuid string) (*reload.Report, error) {
+	var err error
+	var report *reload.Report
+	qerr := reloads.Do(uuid, func() {
+		if cache.GetState(uuid) != session.StateCanary {
+			err = libErrors.ErrNotExist
+			report = &reload.Report{Lines: []string{"No canary of this session is waiting for promotion"}}
+			return
+		}
+
+		waves := allWaves
+		if run := canaries.remove(uuid); run != nil {
+			waves = firstWaves(-1, run.inst)
+		}
+		cache.SetCanary(uuid, nil)
+		report, err = rollbackSession(d, uuid, waves)
+	})
+	if qerr != nil {
+		return nil, qerr
+	}
+	return report, err
+}
+
+// reloadPromoteHandler reloads the other instances of a session whose
+// canary has been reloaded.
+var reloadPromoteHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return canaryHandler(w, r, d, func(d *data, uuid string) (*reload.Report, error) {
+		return promoteCanary(d, uuid, nil)
+	})
+})
+
+// reloadAbortHandler rolls back a session whose canary has been reloaded,
+// the canary is reloaded with the restored files.
+var reloadAbortHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return canaryHandler(w, r, d, abortCanary)
+})
+
+func canaryHandler(w http.ResponseWriter, r *http.Request, d *data,
+	fn func(d *data, uuid string) (*reload.Report, error)) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	sess, found := cache.Session(uuid)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Upload session not found or expired!\n"))
+		return http.StatusNotFound, nil
+	}
+
+	if !d.user.Perm.Admin && sess.UserID != d.user.ID {
+		return http.StatusForbidden, nil
+	}
+	d, err := sessionData(d, sess)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	report, err := fn(d, uuid)
+	if report == nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("This session is currently hot reloading, please try again later!\n"))
+		return http.StatusConflict, nil
+	}
+
+	w.WriteHeader(errToStatus(err))
+
+	status := "OK"
+	if errToStatus(err) != http.StatusOK {
+		status = "Error"
+	}
+
+	rsp := &response{
+		Status:  status,
+		Msg:     report.Lines,
+		Results: report.Results,
+	}
+
+	if _, err := renderJSONIndent(w, r, rsp); err != nil {
+		return errToStatus(err), err
+	}
+
+	// the status has already been written with the response
+	return 0, err
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+func TestRestoreCanaries(t *testing.T) {
+	s := newTestServer(t, false)
+	promote := time.Now().Add(time.Hour).Unix()
+	for uuid, canary := range map[string]*session.Canary{
+		"timed":  {Inst: "1", Promote: promote},
+		"manual": {Inst: "[1,2]"},
+	} {
+		uuid := uuid
+		require.True(t, cache.Set(uuid, 1, map[string]*CacheData{}, duration))
+		t.Cleanup(func() {
+			canaries.remove(uuid)
+			cache.Del(uuid)
+		})
+		require.True(t, cache.SetState(uuid, session.StateCanary))
+		require.True(t, cache.SetCanary(uuid, canary))
+	}
+	// the sessions reloaded without canary are left alone
+	require.True(t, cache.Set("plain", 1, map[string]*CacheData{}, duration))
+	t.Cleanup(func() { cache.Del("plain") })
+	require.True(t, cache.SetState("plain", session.StateCanary))
+
+	require.NoError(t, restoreCanaries(s.store, s.server))
+
+	run := canaries.remove("timed")
+	require.NotNil(t, run)
+	assert.Equal(t, "1", run.inst)
+	assert.Equal(t, promote, run.promote.Unix())
+	assert.NotNil(t, run.timer)
+
+	run = canaries.remove("manual")
+	require.NotNil(t, run)
+	assert.Equal(t, "[1,2]", run.inst)
+	assert.Nil(t, run.timer)
+
+	assert.Nil(t, canaries.remove("plain"))
+}
@@ -0,0 +1,296 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage"
+)
+
+// stagingDir holds the staged uploads of each session until it is committed.
+const stagingDir = "/.staging"
+
+// stagePath is where the upload of the file at path is staged.
+func stagePath(uuid, path string) string {
+	return filepath.Join(stagingDir, uuid, path)
+}
+
+// inStaging tells whether path is in the staging directory, which is only
+// reachable through the sessions.
+func inStaging(path string) bool {
+	path = filepath.Clean("/" + path)
+	return path == stagingDir || strings.HasPrefix(path, stagingDir+"/")
+}
+
+// dropStaging removes the staged uploads and chunks of a session which
+// expired before it was committed from the scope of its uploader.
+func dropStaging(store *storage.Storage, server *settings.Server, sess *session.Session) {
+	user, err := store.Users.Get(server.Root, sess.UserID)
+	if err != nil {
+		log.Printf("drop staging of session %s failed: %v", sess.UUID, err)
+		return
+	}
+	if err := user.Fs.RemoveAll(filepath.Join(stagingDir, sess.UUID)); err != nil {
+		log.Printf("drop staging of session %s failed: %v", sess.UUID, err)
+	}
+}
+
+// reloadCommitHandler swaps the staged files of a session into place
+// without reloading.
+var reloadCommitHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	sess, found := cache.Session(uuid)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Upload session not found or expired, nothing to commit!\n"))
+		return http.StatusNotFound, nil
+	}
+
+	if !d.user.Perm.Admin && sess.UserID != d.user.ID {
+		return http.StatusForbidden, nil
+	}
+	d, err := sessionData(d, sess)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	var out []string
+	// Commits share the queue with the reloads, so no reload sees half of them
+	qerr := reloads.Do(uuid, func() {
+		if err = checkApproved(d, uuid); err != nil {
+			out = []string{"This session must be approved before it is committed"}
+			return
+		}
+		out, err = commitSession(d, uuid)
+	})
+	if qerr != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("This session is currently hot reloading, please try again later!\n"))
+		return http.StatusConflict, nil
+	}
+
+	w.WriteHeader(errToStatus(err))
+
+	status := "OK"
+	if errToStatus(err) != http.StatusOK {
+		status = "Error"
+	}
+
+	rsp := &response{
+		Status: status,
+		Msg:    out,
+	}
+
+	if _, err := renderJSONIndent(w, r, rsp); err != nil {
+		return errToStatus(err), err
+	}
+
+	// the status has already been written with the response
+	return 0, err
+})
+
+// commitSession swaps the staged files of the session into place, one
+// upload directory at a time with commitDir, so the processes never see a
+// half-updated directory. The replaced files are moved to the backup
+// directory of the session as if they had been uploaded directly.
+func commitSession(d *data, uuid string) ([]string, error) {
+	found, vals := cache.Get(uuid)
+	if !found {
+		return []string{"Upload session expired while waiting for commit"}, libErrors.ErrNotExist
+	}
+
+	stage := filepath.Join(stagingDir, uuid)
+	if _, err := d.user.Fs.Stat(stage); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	absdirs := make([]string, 0, len(vals))
+	for absdir, cd := range vals {
+		if cd != nil {
+			absdirs = append(absdirs, absdir)
+		}
+	}
+	sort.Strings(absdirs)
+
+	var out []string
+	for _, absdir := range absdirs {
+		dir := scopePath(d.user.Scope, absdir)
+		var staged []string
+		for _, full := range setToSortedSlice(vals[absdir].files) {
+			path := scopePath(d.user.Scope, full)
+			if _, err := d.user.Fs.Stat(stagePath(uuid, path)); err == nil {
+				staged = append(staged, path)
+			}
+		}
+		if len(staged) == 0 {
+			continue
+		}
+
+		if err := commitDir(d, uuid, absdir, dir, staged); err != nil {
+			log.Printf("commit %s of session %s failed: %v", dir, uuid, err)
+			return out, err
+		}
+		for _, path := range staged {
+			out = append(out, "committed "+path)
+		}
+	}
+
+	return out, d.user.Fs.RemoveAll(stage)
+}
+
+// commitDir swaps the staged files of the upload directory dir into place.
+// The deepest directory holding all of them is rebuilt next to the live
+// one, with hard links to its unchanged files, and then exchanged with it
+// in one step. The staged files are only removed once they are live, a
+// failed commit can be retried.
+func commitDir(d *data, uuid, absdir, dir string, staged []string) error {
+	root := commonDir(dir, staged)
+	nextDir := root + "." + uuid + ".next"
+	live := d.user.FullPath(root)
+	next := d.user.FullPath(nextDir)
+
+	// leftovers of a failed commit
+	if err := os.RemoveAll(next); err != nil {
+		return err
+	}
+	_, err := os.Lstat(live)
+	exists := err == nil
+	if exists {
+		err = linkTree(live, next)
+	} else {
+		err = os.MkdirAll(next, 0775)
+	}
+	if err == nil {
+		err = linkStaged(d, uuid, root, next, staged)
+	}
+	if err == nil {
+		err = swapDir(next, live, exists)
+	}
+	if err != nil {
+		_ = os.RemoveAll(next)
+		return err
+	}
+
+	// the staged files are live, the original versions are left in next
+	for _, path := range staged {
+		if err := d.user.Fs.Remove(stagePath(uuid, path)); err != nil {
+			log.Printf("remove the staged %s of session %s failed: %v", path, uuid, err)
+		}
+	}
+	for _, path := range staged {
+		full := filepath.Join(d.user.Scope, path)
+		rel, _ := filepath.Rel(dir, path)
+		relRoot, _ := filepath.Rel(root, path)
+		if _, err := os.Lstat(filepath.Join(next, relRoot)); err != nil {
+			if err := cache.AddCreated(uuid, absdir, full); err != nil {
+				return err
+			}
+			continue
+		}
+		// only the version before the session is backed up
+		if cache.IsCreated(uuid, absdir, full) {
+			continue
+		}
+		if bakdir := cache.GetBakDir(uuid, absdir); bakdir != "" {
+			if _, err := d.user.Fs.Stat(filepath.Join(bakdir, rel)); err == nil {
+				continue
+			}
+		}
+		if _, err := backupFile(d.user.Fs, uuid, absdir, dir, rel, filepath.Join(nextDir, relRoot)); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(next)
+}
+
+// swapDir puts the directory next in place of live in one step.
+func swapDir(next, live string, exists bool) error {
+	if exists {
+		return exchange(next, live)
+	}
+	// nothing to swap with, the directory is new
+	if err := os.MkdirAll(filepath.Dir(live), 0775); err != nil {
+		return err
+	}
+	return os.Rename(next, live)
+}
+
+// commonDir returns the deepest directory holding the files at paths,
+// which are in dir.
+func commonDir(dir string, paths []string) string {
+	if len(paths) == 0 {
+		return dir
+	}
+	common := filepath.Dir(paths[0])
+	for _, path := range paths[1:] {
+		for common != dir && !strings.HasPrefix(path, common+"/") {
+			common = filepath.Dir(common)
+		}
+	}
+	if common != dir && !strings.HasPrefix(common, dir+"/") {
+		return dir
+	}
+	return common
+}
+
+// linkStaged links the staged files to their place in next, the rebuilt
+// directory root.
+func linkStaged(d *data, uuid, root, next string, staged []string) error {
+	for _, path := range staged {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(next, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+			return err
+		}
+		// replacing the link leaves the live file untouched
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Link(d.user.FullPath(stagePath(uuid, path)), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkTree recreates the tree of src at dst, with hard links to its files.
+func linkTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return os.Link(path, target)
+		}
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package http
+
+import (
+	"errors"
+	"os"
+)
+
+// exchange swaps the directories at a and b atomically, which only Linux
+// supports: replacing a directory in two renames would leave it missing
+// in between. The settings refuse staging on the other platforms.
+func exchange(a, b string) error {
+	return &os.LinkError{Op: "exchange", Old: a, New: b, Err: errors.New("not supported on this platform")}
+}
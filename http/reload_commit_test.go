@@ -0,0 +1,94 @@
+package http
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+func TestCommonDir(t *testing.T) {
+	assert.Equal(t, "/cfg/a", commonDir("/cfg", []string{"/cfg/a/x.xml", "/cfg/a/y.xml"}))
+	assert.Equal(t, "/cfg/a", commonDir("/cfg", []string{"/cfg/a/b/x.xml", "/cfg/a/y.xml"}))
+	assert.Equal(t, "/cfg", commonDir("/cfg", []string{"/cfg/a/x.xml", "/cfg/ab/y.xml"}))
+	assert.Equal(t, "/cfg", commonDir("/cfg", []string{"/cfg/x.xml"}))
+}
+
+func TestCommitDir(t *testing.T) {
+	d := newTestData(t)
+	const uuid, dir = "commit", "/ClientConfig"
+	newTestSession(t, d, uuid, dir)
+	absdir := filepath.Join(d.user.Scope, dir)
+
+	write := func(path, content string) {
+		full := d.user.FullPath(path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0775))
+		require.NoError(t, ioutil.WriteFile(full, []byte(content), 0644))
+	}
+	read := func(path string) string {
+		b, err := ioutil.ReadFile(d.user.FullPath(path))
+		require.NoError(t, err)
+		return string(b)
+	}
+	stat := func(path string) os.FileInfo {
+		info, err := os.Stat(d.user.FullPath(path))
+		require.NoError(t, err)
+		return info
+	}
+
+	write("/ClientConfig/sub/a.xml", "old a")
+	write("/ClientConfig/sub/b.xml", "b")
+	write("/ClientConfig/other/c.xml", "c")
+	write(stagePath(uuid, "/ClientConfig/sub/a.xml"), "new a")
+	write(stagePath(uuid, "/ClientConfig/sub/new.xml"), "new")
+	other := stat("/ClientConfig/other/c.xml")
+	staged := []string{"/ClientConfig/sub/a.xml", "/ClientConfig/sub/new.xml"}
+
+	// a failed commit leaves the live files and the staged ones as they were
+	err := commitDir(d, uuid, absdir, dir, append(staged, "/ClientConfig/sub/missing.xml"))
+	require.Error(t, err)
+	assert.Equal(t, "old a", read("/ClientConfig/sub/a.xml"))
+	assert.Equal(t, "new a", read(stagePath(uuid, "/ClientConfig/sub/a.xml")))
+	_, err = os.Stat(d.user.FullPath("/ClientConfig/sub." + uuid + ".next"))
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, commitDir(d, uuid, absdir, dir, staged))
+	assert.Equal(t, "new a", read("/ClientConfig/sub/a.xml"))
+	assert.Equal(t, "new", read("/ClientConfig/sub/new.xml"))
+	assert.Equal(t, "b", read("/ClientConfig/sub/b.xml"))
+	// only the directory of the staged files is rebuilt
+	assert.True(t, os.SameFile(other, stat("/ClientConfig/other/c.xml")))
+	_, err = os.Stat(d.user.FullPath(stagePath(uuid, "/ClientConfig/sub/a.xml")))
+	assert.True(t, os.IsNotExist(err))
+
+	// the originals are backed up for the rollback
+	bakdir := cache.GetBakDir(uuid, absdir)
+	require.NotEmpty(t, bakdir)
+	assert.Equal(t, "old a", read(filepath.Join(bakdir, "sub/a.xml")))
+	assert.True(t, cache.IsCreated(uuid, absdir, filepath.Join(d.user.Scope, "/ClientConfig/sub/new.xml")))
+	_, err = os.Stat(d.user.FullPath("/ClientConfig/sub." + uuid + ".next"))
+	assert.True(t, os.IsNotExist(err))
+
+	// a new directory is moved into place
+	write(stagePath(uuid, "/ClientConfig/dir/x.xml"), "x")
+	require.NoError(t, commitDir(d, uuid, absdir, dir, []string{"/ClientConfig/dir/x.xml"}))
+	assert.Equal(t, "x", read("/ClientConfig/dir/x.xml"))
+}
+
+func TestDropStaging(t *testing.T) {
+	s := newTestServer(t, true)
+	const uuid = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	s.write(filepath.Join("owner", stagePath(uuid, "/ClientConfig/a.db")), "staged")
+	s.write(filepath.Join("owner", chunkPath(uuid, "/ClientConfig/b.db")), "chunk")
+	s.write("owner/ClientConfig/a.db", "live")
+
+	dropStaging(s.store, s.server, &session.Session{UUID: uuid, UserID: 1})
+	_, err := os.Stat(filepath.Join(s.server.Root, "owner", stagingDir, uuid))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, "live", s.read("owner/ClientConfig/a.db"))
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/diff"
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// defaultSQLite is the sqlite3 binary comparing the db files when the
+// validation settings have none.
+const defaultSQLite = "sqlite3"
+
+// fileDiff is the change of a file of a session against its version before
+// the session: the tables of the db files and the elements of the xml files.
+type fileDiff struct {
+	File   string        `json:"file"`
+	Kind   diff.Kind     `json:"kind"` // empty if the file is unchanged
+	Tables []*diff.Table `json:"tables,omitempty"`
+	XML    *diff.XMLDiff `json:"xml,omitempty"`
+	Error  string        `json:"error,omitempty"` // the content could not be compared
+}
+
+// sessionDiff is the changes of the files of a session.
+type sessionDiff struct {
+	UUID  string      `json:"uuid"`
+	Files []*fileDiff `json:"files"`
+}
+
+// reloadDiffHandler compares the files of a session with the versions
+// they replace, staged or not, in the scope of its uploader. Only the
+// uploader, admins and approvers can see it.
+var reloadDiffHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	sess, found := cache.Session(uuid)
+	if !found {
+		return http.StatusNotFound, nil
+	}
+	if !canSeeSession(d, sess) {
+		return http.StatusForbidden, nil
+	}
+	d, err := sessionData(d, sess)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	res, err := newSessionDiff(d, uuid)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	return renderJSON(w, r, res)
+})
+
+func newSessionDiff(d *data, uuid string) (*sessionDiff, error) {
+	sess, found := cache.Session(uuid)
+	if !found {
+		return nil, libErrors.ErrNotExist
+	}
+
+	absdirs := make([]string, 0, len(sess.Dirs))
+	for absdir := range sess.Dirs {
+		absdirs = append(absdirs, absdir)
+	}
+	sort.Strings(absdirs)
+
+	res := &sessionDiff{UUID: uuid, Files: []*fileDiff{}}
+	for _, absdir := range absdirs {
+		v := sess.Dirs[absdir]
+		dir := scopePath(d.user.Scope, absdir)
+		for _, full := range v.Files {
+			path := scopePath(d.user.Scope, full)
+			oldPath, newPath := fileVersions(d.user.Fs, uuid, dir, v.BakDir, path)
+			res.Files = append(res.Files, diffFile(d, path, oldPath, newPath))
+		}
+	}
+	return res, nil
+}
+
+// fileVersions finds the version of the file at path before the session
+// and its uploaded version. The original is the live file while the upload
+// is staged, and is then moved to the backup directory. oldPath is empty
+// if the session created the file.
+func fileVersions(fs afero.Fs, uuid, dir, bakdir, path string) (oldPath, newPath string) {
+	if staged := stagePath(uuid, path); exists(fs, staged) {
+		if exists(fs, path) {
+			oldPath = path
+		}
+		return oldPath, staged
+	}
+
+	if rel, err := filepath.Rel(dir, path); err == nil && bakdir != "" {
+		if bak := filepath.Join(bakdir, rel); exists(fs, bak) {
+			oldPath = bak
+		}
+	}
+	return oldPath, path
+}
+
+func exists(fs afero.Fs, path string) bool {
+	_, err := fs.Stat(path)
+	return err == nil
+}
+
+func diffFile(d *data, path, oldPath, newPath string) *fileDiff {
+	res := &fileDiff{File: path}
+	switch {
+	case !exists(d.user.Fs, newPath):
+		res.Error = "the uploaded file is missing"
+		return res
+	case oldPath == "":
+		res.Kind = diff.Added
+	case checksum(d.user.Fs, oldPath) == checksum(d.user.Fs, newPath):
+		return res
+	default:
+		res.Kind = diff.Modified
+	}
+
+	// the tools read the files from the disk
+	if oldPath != "" {
+		oldPath = d.user.FullPath(oldPath)
+	}
+	newPath = d.user.FullPath(newPath)
+
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db":
+		bin := d.settings.Validation.SQLite
+		if bin == "" {
+			bin = defaultSQLite
+		}
+		res.Tables, err = diff.SQLite(bin, oldPath, newPath)
+	case ".xml":
+		res.XML, err = diff.XML(oldPath, newPath)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
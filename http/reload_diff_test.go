@@ -0,0 +1,49 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filebrowser/filebrowser/v2/diff"
+)
+
+func TestReloadDiffAccess(t *testing.T) {
+	s := newTestServer(t, false)
+	const uuid = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	require.True(t, cache.Set(uuid, 1, map[string]*CacheData{}, duration))
+	t.Cleanup(func() { cache.Del(uuid) })
+
+	diff := func(userID uint, uuid string) int {
+		return s.do(reloadDiffHandler, "", userID, "GET", "/api/reload/diff?uuid="+uuid, nil).Code
+	}
+	assert.Equal(t, http.StatusOK, diff(1, uuid))
+	assert.Equal(t, http.StatusForbidden, diff(2, uuid))
+	assert.Equal(t, http.StatusOK, diff(3, uuid))
+	assert.Equal(t, http.StatusOK, diff(4, uuid))
+	assert.Equal(t, http.StatusNotFound, diff(1, "0f8fad5b-d9cb-469f-a165-70867728950e"))
+}
+
+func TestReloadDiffOfAnotherScope(t *testing.T) {
+	s := newTestServer(t, true)
+	const uuid = "8a1b2c3d-4e5f-4a6b-9c7d-8e9f0a1b2c3d"
+	t.Cleanup(func() { cache.Del(uuid) })
+	s.write("owner/ClientConfig/a.xml", "<root><item id=\"1\"/></root>")
+	target := "/api/resources/ClientConfig/a.xml?override=true&dir=/ClientConfig&uuid=" + uuid
+	w := s.do(resourcePostPutHandler, "/api/resources", 1, "POST", target, strings.NewReader("<root><item id=\"2\"/></root>"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// the approver sees the files of the uploader
+	w = s.do(reloadDiffHandler, "", 4, "GET", "/api/reload/diff?uuid="+uuid, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var res sessionDiff
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Len(t, res.Files, 1)
+	assert.Equal(t, "/ClientConfig/a.xml", res.Files[0].File)
+	assert.Empty(t, res.Files[0].Error)
+	assert.Equal(t, diff.Modified, res.Files[0].Kind)
+}
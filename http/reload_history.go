@@ -0,0 +1,154 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/history"
+	"github.com/filebrowser/filebrowser/v2/reload"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+// recordHistory saves a reload or a rollback of a session in the history.
+// Failing to do so is only logged, the action is already done.
+func recordHistory(d *data, action history.Action, start time.Time, uuid string,
+	dirs map[string]*session.Dir, proc string, report *reload.Report, err error) {
+	saveHistory(d, historyEntry(d, action, start, uuid, dirs, proc, report, err))
+}
+
+func saveHistory(d *data, entry *history.Entry) {
+	if err := d.store.History.Save(entry); err != nil {
+		log.Printf("save the %s of session %s in the history failed: %v", entry.Action, entry.UUID, err)
+	}
+}
+
+// historyEntry describes an action on a session, with the checksums of the
+// uploaded versions of its files.
+func historyEntry(d *data, action history.Action, start time.Time, uuid string,
+	dirs map[string]*session.Dir, proc string, report *reload.Report, err error) *history.Entry {
+	entry := &history.Entry{
+		UUID:     uuid,
+		Action:   action,
+		UserID:   d.user.ID,
+		Username: d.user.Username,
+		Time:     start,
+		Proc:     proc,
+		Status:   "OK",
+		Results:  []*reload.Result{},
+	}
+	if err != nil {
+		entry.Status = "Error"
+		entry.Error = err.Error()
+	}
+	if report != nil && report.Results != nil {
+		entry.Results = report.Results
+	}
+
+	entry.Files, entry.BakDirs = uploadedFiles(d, uuid, dirs)
+	return entry
+}
+
+// uploadedFiles lists the files of a session with the checksums of their
+// uploaded versions, and the backup directories of the session.
+func uploadedFiles(d *data, uuid string, dirs map[string]*session.Dir) ([]history.File, []string) {
+	files, bakdirs := []history.File{}, []string{}
+	keys := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		keys = append(keys, dir)
+	}
+	sort.Strings(keys)
+
+	for _, dir := range keys {
+		v := dirs[dir]
+		if v.BakDir != "" {
+			bakdirs = append(bakdirs, v.BakDir)
+		}
+
+		created := map[string]bool{}
+		for _, full := range v.Created {
+			created[full] = true
+		}
+		for _, full := range v.Files {
+			path := scopePath(d.user.Scope, full)
+			// the staged version until the session is committed
+			_, uploaded := fileVersions(d.user.Fs, uuid, scopePath(d.user.Scope, dir), v.BakDir, path)
+			files = append(files, history.File{
+				Path:    path,
+				SHA256:  checksum(d.user.Fs, uploaded),
+				Created: created[full],
+			})
+		}
+	}
+	return files, bakdirs
+}
+
+// checksum returns the hex encoded sha256 of a file, or an empty string if
+// it can't be read.
+func checksum(fs afero.Fs, path string) string {
+	f, err := fs.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reloadHistoryGetHandler lists the reloads, rollbacks and reviews, the
+// latest first. They can be filtered with the uuid, user, since, until and
+// limit query parameters. Users who are neither admins nor approvers only
+// see their own.
+var reloadHistoryGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	query := r.URL.Query()
+	q := &history.Query{UUID: query.Get("uuid")}
+
+	if name := query.Get("user"); name != "" {
+		u, err := d.store.Users.Get(d.server.Root, name)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		q.UserID = u.ID
+	}
+	if !d.user.Perm.Admin && !d.user.Perm.Approve {
+		if q.UserID != 0 && q.UserID != d.user.ID {
+			return http.StatusForbidden, nil
+		}
+		q.UserID = d.user.ID
+	}
+
+	var err error
+	if since := query.Get("since"); since != "" {
+		if q.Since, err = history.ParseTime(since); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if q.Until, err = history.ParseTime(until); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 0 {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	entries, err := d.store.History.Find(q)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return renderJSON(w, r, entries)
+})
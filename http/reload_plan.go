@@ -0,0 +1,327 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// dbTarget is a db file of the session and the processes loading it
+// according to SvrLoadList.xml.
+type dbTarget struct {
+	File  string   `json:"file"`
+	Name  string   `json:"name"`
+	Procs []string `json:"procs"`
+}
+
+// fileTarget is an xml or ServerConfig file of the session and the
+// processes loading it according to SvrLoadList.xml.
+type fileTarget struct {
+	File  string   `json:"file"`
+	Procs []string `json:"procs"`
+}
+
+// reloadWave is a set of processes reloaded together, the waves of a plan
+// are reloaded in order.
+type reloadWave struct {
+	Servers []string `json:"servers"`
+	Proc    string   `json:"proc"`
+}
+
+// reloadPlan describes what reloading a session would do.
+type reloadPlan struct {
+	UUID        string                  `json:"uuid"`
+	State       session.State           `json:"state"`
+	SvrLoadList string                  `json:"svrLoadList"`
+	Dirs        map[string]*session.Dir `json:"dirs"`
+	DBs         []*dbTarget             `json:"dbs"`
+	XMLs        []*fileTarget           `json:"xmls"`
+	Svrs        []*fileTarget           `json:"svrs"`
+	FullReload  []string                `json:"fullReload"` // files no server declares, which require reloading every process
+	Proc        string                  `json:"proc"`       // empty if there is nothing to reload
+	Waves       []*reloadWave           `json:"waves"`      // the order the processes of proc are reloaded in
+	Canary      []*reloadWave           `json:"canary"`     // the waves of the canary if it is requested
+}
+
+func svrLoadListPath(d *data) string {
+	return d.user.FullPath("/wedo/ClientConfig/CSCommon/DB/SvrLoadList.xml")
+}
+
+// newReloadPlan builds the reload plan of a session without modifying it.
+func newReloadPlan(d *data, uuid string) (*reloadPlan, error) {
+	sess, found := cache.Session(uuid)
+	if !found {
+		return nil, libErrors.ErrNotExist
+	}
+
+	xmlFile := svrLoadListPath(d)
+	plan := &reloadPlan{
+		UUID:        sess.UUID,
+		State:       sess.State,
+		SvrLoadList: xmlFile,
+		Dirs:        sess.Dirs,
+		DBs:         []*dbTarget{},
+		XMLs:        []*fileTarget{},
+		Svrs:        []*fileTarget{},
+		FullReload:  []string{},
+		Waves:       []*reloadWave{},
+	}
+
+	dirs := make([]string, 0, len(sess.Dirs))
+	for dir := range sess.Dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	list, err := loadSvrLoadList(d, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	var svrs []string
+	for _, dir := range dirs {
+		v := sess.Dirs[dir]
+		for _, db := range v.DBs {
+			dbName := strings.TrimSuffix(filepath.Base(db), ".db")
+			target := &dbTarget{
+				File:  db,
+				Name:  dbName,
+				Procs: list.DBs[dbName],
+			}
+			if target.Procs == nil {
+				target.Procs = []string{}
+			}
+			svrs = append(svrs, target.Procs...)
+			plan.DBs = append(plan.DBs, target)
+		}
+
+		// the xml and ServerConfig files no server declares are fully reloaded
+		for _, xml := range v.XMLs {
+			procs := list.xmlProcs(xml)
+			if procs == nil {
+				plan.FullReload = append(plan.FullReload, xml)
+				continue
+			}
+			svrs = append(svrs, procs...)
+			plan.XMLs = append(plan.XMLs, &fileTarget{File: xml, Procs: procs})
+		}
+		for _, svr := range v.Svrs {
+			procs := list.svrProcs(svr)
+			if procs == nil {
+				plan.FullReload = append(plan.FullReload, svr)
+				continue
+			}
+			svrs = append(svrs, procs...)
+			plan.Svrs = append(plan.Svrs, &fileTarget{File: svr, Procs: procs})
+		}
+	}
+
+	switch {
+	case len(plan.FullReload) > 0:
+		plan.Proc = "*.*.*.*"
+		plan.Waves = append(plan.Waves, &reloadWave{Servers: []string{}, Proc: plan.Proc})
+	case len(svrs) > 0:
+		plan.Proc = getSvrIDsFromSlice(svrs)
+		if plan.Waves, err = newReloadWaves(&d.settings.Reload, svrs); err != nil {
+			return nil, err
+		}
+	default:
+		// no process loads the configs of the session
+		plan.Proc = ""
+	}
+
+	return plan, nil
+}
+
+// procIDs returns the proc IDs of the processes the plan reloads.
+func (p *reloadPlan) procIDs() []string {
+	if len(p.FullReload) > 0 {
+		return []string{"*.*.*.*"}
+	}
+	var ids []string
+	for _, t := range p.DBs {
+		ids = append(ids, t.Procs...)
+	}
+	for _, t := range p.XMLs {
+		ids = append(ids, t.Procs...)
+	}
+	for _, t := range p.Svrs {
+		ids = append(ids, t.Procs...)
+	}
+	return ids
+}
+
+// procsOverlap tells whether two proc IDs match a common process.
+func procsOverlap(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	if len(pa) != len(pb) {
+		return a == b
+	}
+	for i := range pa {
+		if pa[i] != "*" && pb[i] != "*" && pa[i] != pb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// targetConflict returns the key of another session, not reloaded yet,
+// which targets one of the processes of the plan, and the proc ID they
+// share. Reloading them would load the files the other session uploaded
+// so far, unless they are all still staged.
+func targetConflict(d *data, plan *reloadPlan) (key, proc string) {
+	ids := plan.procIDs()
+	if len(ids) == 0 {
+		return "", ""
+	}
+	for _, sess := range cache.Sessions() {
+		if sess.UUID == plan.UUID || sess.State == session.StateReloaded || sess.State == session.StateCanary {
+			continue
+		}
+		od, err := sessionData(d, sess)
+		if err != nil || allStaged(od, sess) {
+			continue
+		}
+		other, err := newReloadPlan(od, sess.UUID)
+		if err != nil {
+			continue
+		}
+		for _, a := range ids {
+			for _, b := range other.procIDs() {
+				if procsOverlap(a, b) {
+					return sess.UUID, a
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// allStaged tells whether none of the uploads of the session is live yet,
+// they are all staged waiting for its commit.
+func allStaged(d *data, sess *session.Session) bool {
+	if !d.settings.Reload.Staging {
+		return false
+	}
+	for _, dir := range sess.Dirs {
+		for _, full := range dir.Files {
+			if _, err := d.user.Fs.Stat(stagePath(sess.UUID, scopePath(d.user.Scope, full))); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newReloadWaves groups the proc IDs by the wave of their servers in the
+// reload order of the settings, a proc ID shared by several servers is
+// reloaded in the wave of the last one.
+func newReloadWaves(r *settings.Reload, procs []string) ([]*reloadWave, error) {
+	levels, err := r.Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	procLevels := map[string]int{}
+	names := map[string][]string{}
+	for name, id := range r.ProcMap {
+		if id == "" {
+			continue
+		}
+		names[id] = append(names[id], name)
+		if levels[name] > procLevels[id] {
+			procLevels[id] = levels[name]
+		}
+	}
+
+	byLevel := map[int][]string{}
+	seen := map[string]bool{}
+	for _, id := range procs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		byLevel[procLevels[id]] = append(byLevel[procLevels[id]], id)
+	}
+
+	order := make([]int, 0, len(byLevel))
+	for l := range byLevel {
+		order = append(order, l)
+	}
+	sort.Ints(order)
+
+	waves := make([]*reloadWave, 0, len(order))
+	for _, l := range order {
+		wave := &reloadWave{Servers: []string{}, Proc: getSvrIDsFromSlice(byLevel[l])}
+		for _, id := range byLevel[l] {
+			wave.Servers = append(wave.Servers, names[id]...)
+		}
+		sort.Strings(wave.Servers)
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
+
+// loadSvrLoadList parses SvrLoadList.xml if the session has configs. It is
+// required to map the db files, without it the xml and ServerConfig files
+// are fully reloaded as they used to be.
+func loadSvrLoadList(d *data, sess *session.Session) (*svrLoadList, error) {
+	empty := &svrLoadList{DBs: map[string][]string{}}
+	hasDBs, hasConfigs := false, false
+	for _, v := range sess.Dirs {
+		hasDBs = hasDBs || len(v.DBs) > 0
+		hasConfigs = hasConfigs || len(v.XMLs) > 0 || len(v.Svrs) > 0
+	}
+	if !hasDBs && !hasConfigs {
+		return empty, nil
+	}
+
+	list, err := parseSvrLoadList(svrLoadListPath(d), d.settings.Reload.ProcMap)
+	if err != nil && !hasDBs {
+		log.Printf("%v, every process is reloaded", err)
+		return empty, nil
+	}
+	return list, err
+}
+
+// reloadPlanHandler shows what reloading a session would do, with the
+// waves of its canary if "canary" is set, without executing anything.
+var reloadPlanHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	sess, found := cache.Session(uuid)
+	if !found {
+		return http.StatusNotFound, nil
+	}
+	if !canSeeSession(d, sess) {
+		return http.StatusForbidden, nil
+	}
+	d, err := sessionData(d, sess)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	canary, err := canaryParams(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	plan, err := newReloadPlan(d, uuid)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if canary != nil {
+		plan.Canary = canaryWaves(plan.Waves, canary.inst)
+	}
+
+	return renderJSON(w, r, plan)
+})
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// newTestData returns the data of the requests of an admin whose scope is a
+// temporary directory.
+func newTestData(t *testing.T) *data {
+	scope := t.TempDir()
+	set := &settings.Settings{}
+	require.NoError(t, set.Reload.Clean())
+	require.NoError(t, set.Validation.Clean())
+	return &data{
+		settings: set,
+		user: &users.User{
+			ID:       1,
+			Username: "admin",
+			Scope:    scope,
+			Fs:       afero.NewBasePathFs(afero.NewOsFs(), scope),
+			Perm:     users.Permissions{Admin: true},
+		},
+	}
+}
+
+// newTestSession opens a session of the user with the configs of the
+// directory dir, it is deleted at the end of the test.
+func newTestSession(t *testing.T, d *data, uuid, dir string, xmls ...string) {
+	absdir := filepath.Join(d.user.Scope, dir)
+	require.True(t, cache.Set(uuid, d.user.ID, map[string]*CacheData{}, duration))
+	t.Cleanup(func() { cache.Del(uuid) })
+	require.True(t, cache.SetCacheData(uuid, absdir, newCacheData()))
+	for _, xml := range xmls {
+		full := filepath.Join(absdir, xml)
+		owner, err := cache.ClaimFile(uuid, absdir, full)
+		require.NoError(t, err)
+		require.Empty(t, owner)
+		require.NoError(t, cache.AddConfig(uuid, absdir, full, ConfigXML))
+	}
+}
+
+func TestNewReloadWaves(t *testing.T) {
+	r := &settings.Reload{
+		ProcMap: map[string]string{
+			"GameSvr":    "*.*.13.*",
+			"MatchSvr":   "*.*.17.*",
+			"ChatSvr":    "*.*.20.*",
+			"TeamSvr":    "*.*.19.*",
+			"MonitorSvr": "",
+		},
+		After: map[string][]string{
+			"MatchSvr": {"GameSvr"},
+			"TeamSvr":  {"MatchSvr", "ChatSvr"},
+		},
+	}
+	require.NoError(t, r.Clean())
+
+	waves, err := newReloadWaves(r, []string{"*.*.19.*", "*.*.13.*", "*.*.20.*", "*.*.13.*"})
+	require.NoError(t, err)
+	require.Len(t, waves, 2)
+	assert.Equal(t, []string{"ChatSvr", "GameSvr"}, waves[0].Servers)
+	assert.Equal(t, []string{"TeamSvr"}, waves[1].Servers)
+	assert.Equal(t, "*.*.[19].*", waves[1].Proc)
+
+	// without an order everything is reloaded at once
+	r.After = nil
+	waves, err = newReloadWaves(r, []string{"*.*.13.*", "*.*.17.*"})
+	require.NoError(t, err)
+	require.Len(t, waves, 1)
+
+	r.After = map[string][]string{"GameSvr": {"MatchSvr"}, "MatchSvr": {"GameSvr"}}
+	assert.True(t, errors.Is(r.Clean(), libErrors.ErrInvalidRequestParams))
+	r.After = map[string][]string{"GameSvr": {"Unknown"}}
+	assert.True(t, errors.Is(r.Clean(), libErrors.ErrInvalidRequestParams))
+}
+
+func TestCanaryWaves(t *testing.T) {
+	waves := []*reloadWave{
+		{Servers: []string{"GameSvr"}, Proc: "*.*.[13].*"},
+		{Servers: []string{"MatchSvr"}, Proc: "*.*.[17].2"},
+	}
+
+	canary := canaryWaves(waves, "1")
+	require.Len(t, canary, 1)
+	assert.Equal(t, "*.*.[13].1", canary[0].Proc)
+	assert.Equal(t, "*.*.[13].*", waves[0].Proc)
+
+	r := httptest.NewRequest("GET", "/api/reload?uuid=x&canary=[1,2]&watch=30", nil)
+	run, err := canaryParams(r)
+	require.NoError(t, err)
+	assert.Equal(t, "[1,2]", run.inst)
+	assert.Equal(t, 30*time.Second, run.watch)
+
+	r = httptest.NewRequest("GET", "/api/reload?uuid=x&canary=*", nil)
+	_, err = canaryParams(r)
+	assert.True(t, errors.Is(err, libErrors.ErrInvalidRequestParams))
+}
+
+func TestProcsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"*.*.13.*", "*.*.13.1", true},
+		{"*.*.13.*", "*.*.17.*", false},
+		{"*.*.*.*", "1.2.17.3", true},
+		{"1.*.13.*", "2.*.13.*", false},
+		{"*.*.13.1", "*.*.13.2", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, procsOverlap(tt.a, tt.b), "%s %s", tt.a, tt.b)
+		assert.Equal(t, tt.want, procsOverlap(tt.b, tt.a), "%s %s", tt.b, tt.a)
+	}
+}
+
+func TestTargetConflict(t *testing.T) {
+	d := newTestData(t)
+	// without SvrLoadList.xml, the xml files are fully reloaded
+	newTestSession(t, d, "conflict-a", "/ClientConfig", "a.xml")
+	newTestSession(t, d, "conflict-b", "/ClientConfig", "b.xml")
+	newTestSession(t, d, "conflict-c", "/ClientConfig")
+
+	plan, err := newReloadPlan(d, "conflict-a")
+	require.NoError(t, err)
+	key, proc := targetConflict(d, plan)
+	assert.Equal(t, "conflict-b", key)
+	assert.Equal(t, "*.*.*.*", proc)
+
+	// the reloaded sessions are over
+	require.True(t, cache.SetState("conflict-b", session.StateReloaded))
+	key, _ = targetConflict(d, plan)
+	assert.Empty(t, key)
+
+	// the staged uploads are not loaded until they are committed
+	require.True(t, cache.SetState("conflict-b", session.StateOpen))
+	d.settings.Reload.Staging = true
+	staged := d.user.FullPath(stagePath("conflict-b", "/ClientConfig/b.xml"))
+	require.NoError(t, os.MkdirAll(filepath.Dir(staged), 0775))
+	require.NoError(t, ioutil.WriteFile(staged, []byte("<b/>"), 0644))
+	key, _ = targetConflict(d, plan)
+	assert.Empty(t, key)
+	require.NoError(t, os.Remove(staged))
+	key, _ = targetConflict(d, plan)
+	assert.Equal(t, "conflict-b", key)
+	d.settings.Reload.Staging = false
+
+	// a session without configs reloads nothing
+	plan, err = newReloadPlan(d, "conflict-c")
+	require.NoError(t, err)
+	require.True(t, cache.SetState("conflict-b", session.StateOpen))
+	key, _ = targetConflict(d, plan)
+	assert.Empty(t, key)
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"sync"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
+
+type reloadJob struct {
+	uuid string
+	fn   func()
+	done chan struct{}
+}
+
+// reloadQueue serializes the reload step of the upload sessions: the
+// sessions upload concurrently, but only one reload runs at a time.
+type reloadQueue struct {
+	mtx     sync.Mutex
+	pending map[string]bool
+	jobs    chan *reloadJob
+}
+
+func newReloadQueue(c int) *reloadQueue {
+	q := &reloadQueue{
+		pending: make(map[string]bool),
+		jobs:    make(chan *reloadJob, c),
+	}
+	go q.run()
+	return q
+}
+
+func (q *reloadQueue) run() {
+	for job := range q.jobs {
+		job.fn()
+		q.mtx.Lock()
+		delete(q.pending, job.uuid)
+		q.mtx.Unlock()
+		close(job.done)
+	}
+}
+
+// Do queues fn for the given session and blocks until it has been executed.
+// A session can only be queued once at a time.
+func (q *reloadQueue) Do(uuid string, fn func()) error {
+	q.mtx.Lock()
+	if q.pending[uuid] {
+		q.mtx.Unlock()
+		return libErrors.ErrExist
+	}
+	q.pending[uuid] = true
+	q.mtx.Unlock()
+
+	job := &reloadJob{
+		uuid: uuid,
+		fn:   fn,
+		done: make(chan struct{}),
+	}
+	q.jobs <- job
+	<-job.done
+	return nil
+}
+
+// IsPending reports whether the session is waiting for or running a reload.
+func (q *reloadQueue) IsPending(uuid string) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.pending[uuid]
+}
+
+// Len returns the number of queued and running reloads.
+func (q *reloadQueue) Len() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.pending)
+}
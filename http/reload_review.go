@@ -0,0 +1,174 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/history"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+// errNotApproved is returned when a session which needs approval is
+// reloaded or committed before it is approved.
+var errNotApproved = fmt.Errorf("the session is not approved: %w", libErrors.ErrPermissionDenied)
+
+// errApprovalOutdated is returned when the files of an approved session
+// are no longer the versions its reviewer approved.
+var errApprovalOutdated = fmt.Errorf("the files changed since the session was approved: %w", libErrors.ErrPermissionDenied)
+
+// checkApproved tells whether the session may go live, which it always may
+// unless the settings require approval. An approved session whose files are
+// not the approved versions is sent back to review.
+func checkApproved(d *data, uuid string) error {
+	if !d.settings.Reload.RequireApproval {
+		return nil
+	}
+	sess, found := cache.Session(uuid)
+	if !found || sess.State != session.StateApproved {
+		return errNotApproved
+	}
+
+	files, _ := uploadedFiles(d, uuid, sess.Dirs)
+	if !reflect.DeepEqual(approvedFiles(files), sess.Approved) {
+		markPending(d, uuid)
+		return errApprovalOutdated
+	}
+	return nil
+}
+
+// approvedFiles maps the files of a review to their checksums.
+func approvedFiles(files []history.File) map[string]string {
+	res := make(map[string]string, len(files))
+	for _, f := range files {
+		res[f.Path] = f.SHA256
+	}
+	return res
+}
+
+// markPending sends a session whose files changed back to review, which
+// may take longer than an upload so the session is kept for a day.
+func markPending(d *data, uuid string) {
+	if d.settings.Reload.RequireApproval {
+		cache.SetState(uuid, session.StatePending)
+		cache.Renew(uuid, reviewDuration)
+	}
+}
+
+// reviewStates are the states a session can be approved or rejected from.
+var reviewStates = map[history.Action][]session.State{
+	history.ActionApprove: {session.StateOpen, session.StatePending},
+	history.ActionReject:  {session.StateOpen, session.StatePending, session.StateApproved},
+}
+
+// reloadApproveHandler approves a session for reload, the files the
+// approver reviewed are recorded in the history with the "comment".
+var reloadApproveHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return reviewHandler(w, r, d, history.ActionApprove)
+})
+
+// reloadRejectHandler rejects a session, it can't be reloaded until new
+// files are uploaded and approved.
+var reloadRejectHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return reviewHandler(w, r, d, history.ActionReject)
+})
+
+func reviewHandler(w http.ResponseWriter, r *http.Request, d *data, action history.Action) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	sess, found := cache.Session(uuid)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Upload session not found or expired!\n"))
+		return http.StatusNotFound, nil
+	}
+
+	if !d.user.Perm.Admin && !d.user.Perm.Approve {
+		return http.StatusForbidden, nil
+	}
+	// the review is done by somebody else
+	if sess.UserID == d.user.ID {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("The uploader of a session can't review it!\n"))
+		return http.StatusForbidden, nil
+	}
+	// the files reviewed are those of the uploader
+	d, err := sessionData(d, sess)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	var out []string
+	// Reviews share the queue with the reloads, a session is not approved
+	// while it is reloaded
+	qerr := reloads.Do(uuid, func() {
+		out, err = reviewSession(d, uuid, action, r.URL.Query().Get("comment"))
+	})
+	if qerr != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("This session is currently hot reloading, please try again later!\n"))
+		return http.StatusConflict, nil
+	}
+
+	w.WriteHeader(errToStatus(err))
+
+	status := "OK"
+	if errToStatus(err) != http.StatusOK {
+		status = "Error"
+	}
+
+	rsp := &response{
+		Status: status,
+		Msg:    out,
+	}
+
+	if _, err := renderJSONIndent(w, r, rsp); err != nil {
+		return errToStatus(err), err
+	}
+
+	// the status has already been written with the response
+	return 0, err
+}
+
+// reviewSession approves or rejects the session and records the decision
+// with the files it applies to.
+func reviewSession(d *data, uuid string, action history.Action, comment string) ([]string, error) {
+	sess, found := cache.Session(uuid)
+	if !found {
+		return []string{"Upload session expired while waiting for review"}, libErrors.ErrNotExist
+	}
+
+	allowed := false
+	for _, state := range reviewStates[action] {
+		allowed = allowed || sess.State == state
+	}
+	if !allowed {
+		return []string{fmt.Sprintf("A %s session can't be %sd", sess.State, action)}, libErrors.ErrExist
+	}
+
+	entry := historyEntry(d, action, time.Now(), uuid, sess.Dirs, "", nil, nil)
+	entry.Comment = comment
+
+	// the approval only holds for the versions of the files reviewed
+	state := session.StateApproved
+	approved := approvedFiles(entry.Files)
+	if action == history.ActionReject {
+		state, approved = session.StateRejected, nil
+	}
+	cache.SetApproved(uuid, approved)
+	cache.SetState(uuid, state)
+	// the uploader gets the usual time to reload the session
+	cache.Renew(uuid, duration)
+	saveHistory(d, entry)
+
+	out := []string{fmt.Sprintf("Session %s by %s", state, d.user.Username)}
+	for _, f := range entry.Files {
+		out = append(out, fmt.Sprintf("%s %s", f.SHA256, f.Path))
+	}
+	return out, nil
+}
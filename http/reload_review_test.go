@@ -0,0 +1,76 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+func TestReviewSession(t *testing.T) {
+	s := newTestServer(t, true)
+	set, err := s.store.Settings.Get()
+	require.NoError(t, err)
+	set.Reload.RequireApproval = true
+	require.NoError(t, s.store.Settings.Save(set))
+
+	const uuid = "9b2c4d1e-3f5a-4b6c-8d7e-0a1b2c3d4e5f"
+	t.Cleanup(func() { cache.Del(uuid) })
+	upload := func(content string) {
+		target := "/api/resources/ClientConfig/a.db?override=true&dir=/ClientConfig&uuid=" + uuid
+		w := s.do(resourcePostPutHandler, "/api/resources", 1, "POST", target, strings.NewReader(content))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	review := func(action string, userID uint) int {
+		fn := map[string]handleFunc{"approve": reloadApproveHandler, "reject": reloadRejectHandler}[action]
+		return s.do(fn, "", userID, "GET", "/api/reload/"+action+"?uuid="+uuid, nil).Code
+	}
+	commit := func() int {
+		return s.do(reloadCommitHandler, "", 1, "GET", "/api/reload/commit?uuid="+uuid, nil).Code
+	}
+
+	upload("v1")
+	assert.Equal(t, session.StatePending, cache.GetState(uuid))
+	// the session is kept while it waits for review
+	assert.Greater(t, cache.TTL(uuid), duration)
+	assert.Equal(t, http.StatusForbidden, commit())
+
+	// the uploader and the users without the approve permission can't review
+	assert.Equal(t, http.StatusForbidden, review("approve", 1))
+	assert.Equal(t, http.StatusForbidden, review("approve", 2))
+	require.Equal(t, http.StatusOK, review("approve", 4))
+	sess, _ := cache.Session(uuid)
+	assert.Equal(t, session.StateApproved, sess.State)
+	assert.Equal(t, map[string]string{"/ClientConfig/a.db": sha256Hex("v1")}, sess.Approved)
+	assert.LessOrEqual(t, cache.TTL(uuid), duration)
+	assert.Equal(t, http.StatusConflict, review("approve", 4))
+
+	// an upload sends the session back to review
+	upload("v2")
+	assert.Equal(t, session.StatePending, cache.GetState(uuid))
+	require.Equal(t, http.StatusOK, review("reject", 3))
+	sess, _ = cache.Session(uuid)
+	assert.Equal(t, session.StateRejected, sess.State)
+	assert.Nil(t, sess.Approved)
+	assert.Equal(t, http.StatusConflict, review("approve", 4))
+	assert.Equal(t, http.StatusForbidden, commit())
+
+	upload("v3")
+	require.Equal(t, http.StatusOK, review("approve", 4))
+	// a file changed behind the review voids the approval
+	staged := filepath.Join(s.server.Root, "owner", stagePath(uuid, "/ClientConfig/a.db"))
+	require.NoError(t, ioutil.WriteFile(staged, []byte("evil"), 0644))
+	assert.Equal(t, http.StatusForbidden, commit())
+	assert.Equal(t, session.StatePending, cache.GetState(uuid))
+
+	require.NoError(t, ioutil.WriteFile(staged, []byte("v3"), 0644))
+	require.Equal(t, http.StatusOK, review("approve", 4))
+	require.Equal(t, http.StatusOK, commit())
+	assert.Equal(t, "v3", s.read("owner/ClientConfig/a.db"))
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/history"
+	"github.com/filebrowser/filebrowser/v2/reload"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+// reloadRollbackHandler restores the files overwritten during a session from
+// its backup directories and deletes the files it created. With reload=true,
+// the affected servers are reloaded afterwards.
+var reloadRollbackHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	sess, found := cache.Session(uuid)
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Upload session not found or expired, nothing to roll back!\n"))
+		return http.StatusNotFound, nil
+	}
+
+	if !d.user.Perm.Admin && sess.UserID != d.user.ID {
+		return http.StatusForbidden, nil
+	}
+	d, err := sessionData(d, sess)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	doReload := r.URL.Query().Get("reload") == "true"
+
+	var report *reload.Report
+	// Rollbacks share the queue with the reloads of the same session
+	qerr := reloads.Do(uuid, func() {
+		var waves rollbackWaves
+		if doReload {
+			waves = allWaves
+		}
+		report, err = rollbackSession(d, uuid, waves)
+	})
+	if qerr != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("This session is currently hot reloading, please try again later!\n"))
+		return http.StatusConflict, nil
+	}
+
+	w.WriteHeader(errToStatus(err))
+
+	status := "OK"
+	if errToStatus(err) != http.StatusOK {
+		status = "Error"
+	}
+
+	rsp := &response{
+		Status:  status,
+		Msg:     report.Lines,
+		Results: report.Results,
+	}
+
+	if _, err := renderJSONIndent(w, r, rsp); err != nil {
+		return errToStatus(err), err
+	}
+
+	// the status has already been written with the response
+	return 0, err
+})
+
+// rollbackWaves selects the waves of the plan of a session which are
+// reloaded once its files are restored.
+type rollbackWaves func(plan *reloadPlan) []*reloadWave
+
+func allWaves(plan *reloadPlan) []*reloadWave {
+	return plan.Waves
+}
+
+// firstWaves selects the n first waves of the plan, all of them if n is
+// negative, or of its canary if inst is not empty.
+func firstWaves(n int, inst string) rollbackWaves {
+	return func(plan *reloadPlan) []*reloadWave {
+		waves := plan.Waves
+		if inst != "" {
+			waves = canaryWaves(waves, inst)
+		}
+		if n >= 0 && n < len(waves) {
+			waves = waves[:n]
+		}
+		return waves
+	}
+}
+
+// rollbackSession restores the files of the session, then reloads the
+// waves of its plan selected by waves, none if it is nil.
+func rollbackSession(d *data, uuid string, waves rollbackWaves) (*reload.Report, error) {
+	mtx.Lock()
+	found, vals := cache.Get(uuid)
+	if !found {
+		mtx.Unlock()
+		return &reload.Report{Lines: []string{"Upload session expired while waiting for rollback"}}, libErrors.ErrNotExist
+	}
+	// the newer version of the file would be lost
+	if owner := cache.Conflict(uuid); owner != "" {
+		mtx.Unlock()
+		return &reload.Report{Lines: []string{"Files of this session are modified by the session " + owner}}, libErrors.ErrSessionConflict
+	}
+	mtx.Unlock()
+
+	// the files of the session are needed for the history once it is over
+	start := time.Now()
+	dirs := map[string]*session.Dir{}
+	if sess, ok := cache.Session(uuid); ok {
+		dirs = sess.Dirs
+	}
+
+	report := &reload.Report{}
+	for absdir, cd := range vals {
+		if cd == nil {
+			continue
+		}
+		dir := scopePath(d.user.Scope, absdir)
+		lines, err := restoreDir(d.user.Fs, d.user.Scope, dir, cd)
+		report.Lines = append(report.Lines, lines...)
+		if err != nil {
+			log.Printf("rollback %s of session %s failed: %v", dir, uuid, err)
+			recordHistory(d, history.ActionRollback, start, uuid, dirs, "", report, err)
+			return report, err
+		}
+	}
+
+	// the staged files were never live
+	if err := d.user.Fs.RemoveAll(filepath.Join(stagingDir, uuid)); err != nil {
+		recordHistory(d, history.ActionRollback, start, uuid, dirs, "", report, err)
+		return report, err
+	}
+
+	var err error
+	var proc string
+	if waves != nil {
+		var plan *reloadPlan
+		if plan, err = newReloadPlan(d, uuid); err != nil {
+			recordHistory(d, history.ActionRollback, start, uuid, dirs, "", report, err)
+			return report, err
+		}
+		reloaded := waves(plan)
+		proc = wavesProc(reloaded)
+		log.Println("procs", proc)
+		var rr *reload.Report
+		rr, _, err = execWaves(d, reloaded, nil)
+		report.Lines = append(report.Lines, rr.Lines...)
+		report.Results = append(report.Results, rr.Results...)
+	}
+	recordHistory(d, history.ActionRollback, start, uuid, dirs, proc, report, err)
+
+	// Files restored, the session is over
+	canaries.remove(uuid)
+	cache.Del(uuid)
+	return report, err
+}
+
+// wavesProc joins the proc expressions of the waves for the history.
+func wavesProc(waves []*reloadWave) string {
+	procs := make([]string, 0, len(waves))
+	for _, wave := range waves {
+		procs = append(procs, wave.Proc)
+	}
+	return strings.Join(procs, " ")
+}
+
+// restoreDir puts back the files of the backup directory of dir and removes
+// the files which were created during the session.
+func restoreDir(fs afero.Fs, scope string, dir string, cd *CacheData) ([]string, error) {
+	var out []string
+	for _, full := range interSliceToStrSlice(cd.created.ToSlice()) {
+		path := scopePath(scope, full)
+		if err := fs.RemoveAll(path); err != nil {
+			return out, err
+		}
+		out = append(out, "deleted "+path)
+	}
+
+	if cd.bakdir == "" {
+		return out, nil
+	}
+	if _, err := fs.Stat(cd.bakdir); os.IsNotExist(err) {
+		return out, nil
+	}
+
+	err := afero.Walk(fs, cd.bakdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(cd.bakdir, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+		if err := fs.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+			return err
+		}
+		if err := fs.Rename(path, dst); err != nil {
+			return err
+		}
+		out = append(out, "restored "+dst)
+		return nil
+	})
+	if err != nil {
+		return out, err
+	}
+
+	return out, fs.RemoveAll(cd.bakdir)
+}
+
+// scopePath converts a path joined with the scope of the user, as the
+// cache keys are, back to a path of the user's filesystem.
+func scopePath(scope string, full string) string {
+	rel, err := filepath.Rel(scope, full)
+	if err != nil {
+		return full
+	}
+	return "/" + filepath.ToSlash(rel)
+}
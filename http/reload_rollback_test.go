@@ -0,0 +1,84 @@
+package http
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreDir(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	write := func(path, content string) {
+		require.NoError(t, afero.WriteFile(fs, path, []byte(content), 0644))
+	}
+	read := func(path string) string {
+		b, err := afero.ReadFile(fs, path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	// the session replaced item.db and sub/skill.xml, and created new.xml
+	write("/ClientConfig/item.db", "new item")
+	write("/ClientConfig/sub/skill.xml", "new skill")
+	write("/ClientConfig/new.xml", "created")
+	write("/ClientConfig/other.xml", "untouched")
+	write("/bak/item.db", "old item")
+	write("/bak/sub/skill.xml", "old skill")
+
+	cd := newCacheData()
+	cd.bakdir = "/bak"
+	cd.created.Add("/scope/ClientConfig/new.xml")
+
+	out, err := restoreDir(fs, "/scope", "/ClientConfig", cd)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"deleted /ClientConfig/new.xml",
+		"restored /ClientConfig/item.db",
+		"restored /ClientConfig/sub/skill.xml",
+	}, out)
+
+	assert.Equal(t, "old item", read("/ClientConfig/item.db"))
+	assert.Equal(t, "old skill", read("/ClientConfig/sub/skill.xml"))
+	assert.Equal(t, "untouched", read("/ClientConfig/other.xml"))
+	exists, err := afero.Exists(fs, "/ClientConfig/new.xml")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = afero.DirExists(fs, "/bak")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// nothing is left to restore
+	out, err = restoreDir(fs, "/scope", "/ClientConfig", newCacheData())
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestSessionOfAnotherScope(t *testing.T) {
+	for _, staging := range []bool{false, true} {
+		t.Run(map[bool]string{false: "live", true: "staging"}[staging], func(t *testing.T) {
+			s := newTestServer(t, staging)
+			const uuid = "5d6e7f80-91a2-4b3c-8d4e-5f6a7b8c9d0e"
+			t.Cleanup(func() { cache.Del(uuid) })
+			s.write("owner/ClientConfig/a.db", "old")
+			target := "/api/resources/ClientConfig/a.db?override=true&dir=/ClientConfig&uuid=" + uuid
+			w := s.do(resourcePostPutHandler, "/api/resources", 1, "POST", target, strings.NewReader("new"))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			// the admin works on the files of the uploader, not on its own
+			if staging {
+				w = s.do(reloadCommitHandler, "", 3, "GET", "/api/reload/commit?uuid="+uuid, nil)
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			}
+			assert.Equal(t, "new", s.read("owner/ClientConfig/a.db"))
+			w = s.do(reloadRollbackHandler, "", 3, "GET", "/api/reload/rollback?uuid="+uuid, nil)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, "old", s.read("owner/ClientConfig/a.db"))
+			assert.NoDirExists(t, filepath.Join(s.server.Root, "ClientConfig"))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/filebrowser/filebrowser/v2/reload"
+)
+
+// reloadStreamHandler reloads the servers of a session, or its canary, like
+// reloadHandler, but streams the output lines and the result of each process as JSON
+// reload events over a WebSocket. The last event is always "done".
+var reloadStreamHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Please upload config first\n"))
+		return http.StatusForbidden, nil
+	}
+
+	sess, found := cache.Session(uuid)
+	if !found {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Upload session not found or expired, please upload config again!\n"))
+		return http.StatusForbidden, nil
+	}
+
+	if !d.user.Perm.Admin && sess.UserID != d.user.ID {
+		return http.StatusForbidden, nil
+	}
+	d, err := sessionData(d, sess)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	canary, err := canaryParams(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer conn.Close()
+
+	// the reload goes on if the client went away, a client which does not
+	// read the events in time is dropped instead of holding up the queue
+	gone := false
+	send := func(e *reload.Event) {
+		if gone {
+			return
+		}
+		err := conn.SetWriteDeadline(time.Now().Add(WSWriteDeadline)) //nolint:shadow
+		if err == nil {
+			err = conn.WriteJSON(e)
+		}
+		if err != nil {
+			log.Printf("drop the reload stream of session %s: %v", uuid, err)
+			gone = true
+		}
+	}
+
+	if n := reloads.Len(); n > 0 {
+		send(&reload.Event{Type: reload.EventLine, Line: fmt.Sprintf("Waiting for %d reloads in the queue", n)})
+	}
+
+	report, err := reloadSession(d, uuid, canary, send)
+	done := &reload.Event{Type: reload.EventDone, Status: "OK"}
+	switch {
+	case report == nil:
+		done.Status = "Error"
+		done.Error = "This session is already waiting for reload"
+	case err != nil:
+		done.Status = "Error"
+		done.Error = err.Error()
+	}
+	send(done)
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(WSWriteDeadline)); err != nil { //nolint:shadow
+		log.Print(err)
+	}
+
+	return 0, nil
+})
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+func TestReloadAccess(t *testing.T) {
+	s := newTestServer(t, false)
+	const uuid = "3f2504e0-4f89-41d3-9a0c-0305e82c3301"
+	require.True(t, cache.Set(uuid, 1, map[string]*CacheData{}, duration))
+	t.Cleanup(func() { cache.Del(uuid) })
+
+	// only the uploader and the admins reload a session
+	w := s.do(reloadHandler, "", 2, "GET", "/api/reload?uuid="+uuid, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = s.do(reloadHandler, "", 4, "GET", "/api/reload?uuid="+uuid, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = s.do(reloadStreamHandler, "", 2, "GET", "/api/reload/stream?uuid="+uuid, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	// the session was left alone
+	assert.Equal(t, session.StateOpen, cache.GetState(uuid))
+}
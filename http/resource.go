@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,6 +18,8 @@ import (
 	"github.com/filebrowser/filebrowser/v2/errors"
 	"github.com/filebrowser/filebrowser/v2/files"
 	"github.com/filebrowser/filebrowser/v2/fileutils"
+	"github.com/filebrowser/filebrowser/v2/session"
+	"github.com/filebrowser/filebrowser/v2/validate"
 
 	libErrors "github.com/filebrowser/filebrowser/v2/errors"
 )
@@ -144,6 +147,16 @@ var resourcePostPutHandler = withUser(func(w http.ResponseWriter, r *http.Reques
 		w.Write([]byte("Operation is prohibited without uuid\n"))
 		return errToStatus(libErrors.ErrPermissionDenied), libErrors.ErrPermissionDenied
 	}
+	if err := checkUUID(uuid); err != nil {
+		return errToStatus(err), err
+	}
+	if !canUploadTo(d, uuid) {
+		return http.StatusForbidden, nil
+	}
+	d, err := uploadData(d, uuid)
+	if err != nil {
+		return errToStatus(err), err
+	}
 
 	dir := r.URL.Query().Get("dir")
 	if dir == "" {
@@ -151,29 +164,23 @@ var resourcePostPutHandler = withUser(func(w http.ResponseWriter, r *http.Reques
 		w.Write([]byte("Operation is prohibited without upload directory\n"))
 		return errToStatus(libErrors.ErrPermissionDenied), libErrors.ErrPermissionDenied
 	}
-	absdir := filepath.Join(d.user.Scope, dir)
-
-	mtx.Lock()
-	if cache.Size() == 0 {
-		vals := make(map[string]*CacheData)
-		// upload all files within one hour
-		// only one key will be successfully set
-		if ok := cache.Set(uuid, vals, duration); !ok {
-			w.WriteHeader(http.StatusForbidden)
-			w.Write([]byte("Cache uuid failed, please try again later!\n"))
-			mtx.Unlock()
-			return errToStatus(libErrors.ErrPermissionDenied), libErrors.ErrPermissionDenied
-		}
+	if !d.Check(r.URL.Path) || !d.Check(dir) {
+		return http.StatusForbidden, nil
 	}
+	absdir := filepath.Join(d.user.Scope, dir)
 
-	// not allowed if uuid not exists
-	if found := cache.IsKeyExisted(uuid); !found {
+	if !openSession(d, uuid) {
 		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("Someone is currently hot reloading, please try again later!\n"))
-		mtx.Unlock()
+		w.Write([]byte("Too many upload sessions in progress, please try again later!\n"))
 		return errToStatus(libErrors.ErrPermissionDenied), libErrors.ErrPermissionDenied
 	}
-	mtx.Unlock()
+
+	// not allowed once the session is waiting for reload or has been reloaded
+	if state := cache.GetState(uuid); reloads.IsPending(uuid) || state == session.StateReloaded || state == session.StateCanary {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("This session is currently hot reloading, please start a new one!\n"))
+		return http.StatusConflict, nil
+	}
 
 	if !d.user.Perm.Create && r.Method == http.MethodPost {
 		return http.StatusForbidden, nil
@@ -208,81 +215,130 @@ var resourcePostPutHandler = withUser(func(w http.ResponseWriter, r *http.Reques
 		action = "save"
 	}
 
-	err := d.RunHook(func() error {
+	// Sessions are independent unless they touch the same file
+	full := filepath.Join(d.user.Scope, r.URL.Path)
+	mtx.Lock()
+	if found := cache.IsDirCacheExisted(uuid, absdir); !found {
+		cache.SetCacheData(uuid, absdir, newCacheData())
+	}
+	// the original is only backed up on the first upload of the file in the session
+	again := cache.HasFile(uuid, absdir, full)
+	owner, err := cache.ClaimFile(uuid, absdir, full)
+	mtx.Unlock()
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if owner != "" {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("The file is being modified in another upload session, please try again later!\n"))
+		return http.StatusConflict, nil
+	}
+
+	// the response of a completed resumable upload may have been lost
+	chunked := r.URL.Query().Get("chunked") == "true"
+	if chunked && again {
+		if dst, done := chunksCompleted(d, uuid, r.URL.Path, r.URL.Query().Get("sha256")); done {
+			err := setETag(w, d.user.Fs, dst)
+			return errToStatus(err), err
+		}
+	}
+
+	// undo puts the original back if the upload fails once the file is replaced
+	var undo func()
+	err = d.RunHook(func() error {
 		name := strings.ReplaceAll(r.URL.Path, dir, "")
 		name = strings.TrimLeft(name, "/")
 
-		err := d.user.Fs.MkdirAll(dir, 0775)
+		// Staged uploads only replace the live files when the session is committed
+		dst := r.URL.Path
+		if d.settings.Reload.Staging {
+			dst = stagePath(uuid, r.URL.Path)
+		}
+
+		err := d.user.Fs.MkdirAll(filepath.Dir(dst), 0775)
 		if err != nil {
 			return err
 		}
 
-		mtx.Lock()
-		if found := cache.IsDirCacheExisted(uuid, absdir); !found {
-			cache.SetCacheData(uuid, absdir, newCacheData())
+		// The upload only replaces the file once it is validated
+		tmp := uploadTmpPath(dst, uuid)
+		defer d.user.Fs.Remove(tmp) //nolint:errcheck
+		if chunked {
+			// a resumable upload is completed with its chunks
+			if err := d.user.Fs.Rename(chunkPath(uuid, r.URL.Path), tmp); err != nil {
+				return err
+			}
+			if sum := r.URL.Query().Get("sha256"); sum != "" && checksum(d.user.Fs, tmp) != sum {
+				return fmt.Errorf("%w: the sha256 of the chunks of %s is not %s",
+					libErrors.ErrInvalidRequestParams, r.URL.Path, sum)
+			}
+		} else if err := writeFile(d.user.Fs, tmp, r.Body); err != nil {
+			return err
+		}
+		if err := validate.File(&d.settings.Validation, r.URL.Path, d.user.FullPath(tmp)); err != nil {
+			return err
 		}
-		mtx.Unlock()
 
-		// If file exists, need backup
-		if _, err := d.user.Fs.Stat(r.URL.Path); err == nil {
-			// Note(youngerli): backup directory with uuid
-			// uuid->dirname->{bak: dirname_uuid_timestamp, files: {xml:Set, db:Set, svr:Set} }
-			mtx.Lock()
-			bakdir := cache.GetBakDir(uuid, absdir)
-			if bakdir == "" {
-				timestamp := time.Unix(time.Now().Unix(), 0).Format("20060102_150405")
-				arr := []string{dir, uuid, timestamp}
-				bakdir = strings.Join(arr, "_")
-				cache.SetBakDir(uuid, absdir, bakdir)
+		if d.settings.Reload.Staging {
+			undo = func() {
+				_ = d.user.Fs.RemoveAll(dst)
 			}
-			// Lock to ensure that the folder has been created
-			src := r.URL.Path
-			dst := filepath.Join(bakdir, name)
-			err = d.user.Fs.MkdirAll(filepath.Dir(dst), 0775)
-			if err != nil {
-				mtx.Unlock()
+			if err := d.user.Fs.Rename(tmp, dst); err != nil {
 				return err
 			}
-			mtx.Unlock()
-			err = d.user.Fs.Rename(src, dst)
+			return setETag(w, d.user.Fs, dst)
+		}
+
+		// If file exists, need backup, otherwise it is removed by a rollback
+		var bak string
+		if _, err := d.user.Fs.Stat(r.URL.Path); err != nil {
+			if !again {
+				if err := cache.AddCreated(uuid, absdir, full); err != nil {
+					return err
+				}
+			}
+		} else if !again {
+			bak, err = backupFile(d.user.Fs, uuid, absdir, dir, name, r.URL.Path)
 			if err != nil {
 				return err
 			}
 		}
 
-		file, err := d.user.Fs.OpenFile(r.URL.Path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0775)
-
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		_, err = io.Copy(file, r.Body)
-		if err != nil {
-			return err
+		undo = func() {
+			if bak == "" {
+				_ = d.user.Fs.RemoveAll(r.URL.Path)
+				return
+			}
+			if err := d.user.Fs.Rename(bak, r.URL.Path); err != nil {
+				log.Printf("restore %s from %s failed: %v", r.URL.Path, bak, err)
+			}
 		}
-
-		// Gets the info about the file.
-		info, err := file.Stat()
-		if err != nil {
+		if err := d.user.Fs.Rename(tmp, r.URL.Path); err != nil {
 			return err
 		}
 
-		etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
-		w.Header().Set("ETag", etag)
-
-		return nil
+		return setETag(w, d.user.Fs, r.URL.Path)
 	}, action, r.URL.Path, "", d.user)
 
 	if err != nil {
-		_ = d.user.Fs.RemoveAll(r.URL.Path)
+		// the previous upload of the file in the session stays
+		if !again {
+			if undo != nil {
+				undo()
+			}
+			cache.ReleaseFile(uuid, absdir, full)
+		}
+		if errToStatus(err) == http.StatusUnprocessableEntity {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(err.Error() + "\n"))
+			return http.StatusUnprocessableEntity, nil
+		}
 	} else { // cache without error
 		// Note(youngerli): Except for the ClientConfig and ServerConfig,
 		// other files or directories are not regarded as configuration so they will not cached
-		// reload strategy: ServerConfig is fully reloaded,
-		// the db in ClientConfig is reloaded according to SvrLoadList.xml,
-		// and the xml is fully reloaded
-		full := filepath.Join(d.user.Scope, r.URL.Path)
+		// reload strategy: the db and xml in ClientConfig and the ServerConfig files
+		// are reloaded according to SvrLoadList.xml, the xml and ServerConfig files
+		// no server declares are fully reloaded
 		mtx.Lock()
 		if strings.Contains(dir, "ClientConfig") {
 			if strings.HasSuffix(full, ".xml") {
@@ -294,11 +350,66 @@ var resourcePostPutHandler = withUser(func(w http.ResponseWriter, r *http.Reques
 			err = cache.AddConfig(uuid, absdir, full, ConfigSVR)
 		}
 		mtx.Unlock()
+		// the approval was for the previous files
+		markPending(d, uuid)
 	}
 
 	return errToStatus(err), err
 })
 
+// backupFile moves the original version of the file at path, named name in
+// the upload directory dir, to the backup directory of dir in the session.
+func backupFile(fs afero.Fs, uuid, absdir, dir, name, path string) (string, error) {
+	// Note(youngerli): backup directory with uuid
+	// uuid->dirname->{bak: dirname_uuid_timestamp, files: {xml:Set, db:Set, svr:Set} }
+	mtx.Lock()
+	bakdir := cache.GetBakDir(uuid, absdir)
+	if bakdir == "" {
+		timestamp := time.Unix(time.Now().Unix(), 0).Format("20060102_150405")
+		arr := []string{dir, uuid, timestamp}
+		bakdir = strings.Join(arr, "_")
+		cache.SetBakDir(uuid, absdir, bakdir)
+	}
+	// Lock to ensure that the folder has been created
+	dst := filepath.Join(bakdir, name)
+	err := fs.MkdirAll(filepath.Dir(dst), 0775)
+	if err != nil {
+		mtx.Unlock()
+		return "", err
+	}
+	mtx.Unlock()
+	return dst, fs.Rename(path, dst)
+}
+
+// setETag sets the ETag header of the response from the info of the file.
+func setETag(w http.ResponseWriter, fs afero.Fs, path string) error {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
+	w.Header().Set("ETag", etag)
+	return nil
+}
+
+// uploadTmpPath is where the upload of a session is written before it
+// replaces the file at path.
+func uploadTmpPath(path, uuid string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+uuid+".upload")
+}
+
+func writeFile(fs afero.Fs, path string, r io.Reader) error {
+	file, err := fs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0775)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, r)
+	return err
+}
+
 var resourcePatchHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	src := r.URL.Path
 	dst := r.URL.Query().Get("destination")
@@ -307,7 +418,7 @@ var resourcePatchHandler = withUser(func(w http.ResponseWriter, r *http.Request,
 	if err != nil {
 		return errToStatus(err), err
 	}
-	if dst == "/" || src == "/" {
+	if dst == "/" || src == "/" || !d.Check(src) || !d.Check(dst) {
 		return http.StatusForbidden, nil
 	}
 	if err = checkParent(src, dst); err != nil {
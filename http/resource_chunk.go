@@ -0,0 +1,147 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/afero"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+// chunkPath is where the chunks of a resumable upload of the file at path
+// are appended. The upload is completed by a POST of the resource with
+// chunked=true, the chunks left over are removed with the staging dir of
+// the session.
+func chunkPath(uuid, path string) string {
+	return filepath.Join(stagingDir, uuid, ".chunks", path)
+}
+
+func chunkOffset(fs afero.Fs, path string) (int64, error) {
+	info, err := fs.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// chunksCompleted tells whether the chunks of the file at path were already
+// completed into the upload of the session with the sha256 sum, so that a
+// retried completion succeeds. It returns where the upload is.
+func chunksCompleted(d *data, uuid, path, sum string) (string, bool) {
+	if sum == "" {
+		return "", false
+	}
+	if _, err := d.user.Fs.Stat(chunkPath(uuid, path)); !os.IsNotExist(err) {
+		return "", false
+	}
+	dst := path
+	if d.settings.Reload.Staging {
+		dst = stagePath(uuid, path)
+	}
+	return dst, checksum(d.user.Fs, dst) == sum
+}
+
+// checkChunkSession fails if the uuid of the request is not a uuid, or if
+// the user may not upload the file at path in its session.
+func checkChunkSession(d *data, uuid, path string) (int, error) {
+	if err := checkUUID(uuid); err != nil {
+		return errToStatus(err), err
+	}
+	if !d.user.Perm.Create || !d.Check(path) || !canUploadTo(d, uuid) {
+		return http.StatusForbidden, nil
+	}
+	return 0, nil
+}
+
+// chunkHeadHandler tells in the Upload-Offset header how many bytes of the
+// file have been received, an interrupted upload resumes from there.
+var chunkHeadHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if status, err := checkChunkSession(d, uuid, r.URL.Path); status != 0 {
+		return status, err
+	}
+	d, err := uploadData(d, uuid)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	offset, err := chunkOffset(d.user.Fs, chunkPath(uuid, r.URL.Path))
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+})
+
+// chunkPatchHandler appends the request body to the chunks of the file if
+// the offset query parameter matches the bytes received so far, otherwise
+// it fails with 409. Either way the Upload-Offset header tells the new
+// offset.
+var chunkPatchHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	if status, err := checkChunkSession(d, uuid, r.URL.Path); status != 0 {
+		return status, err
+	}
+	d, err := uploadData(d, uuid)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// not allowed once the session is waiting for reload or has been reloaded
+	if state := cache.GetState(uuid); reloads.IsPending(uuid) || state == session.StateReloaded || state == session.StateCanary {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("This session is currently hot reloading, please start a new one!\n"))
+		return http.StatusConflict, nil
+	}
+	// the chunks belong to the session of the user from the first one
+	if !openSession(d, uuid) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Too many upload sessions in progress, please try again later!\n"))
+		return errToStatus(libErrors.ErrPermissionDenied), libErrors.ErrPermissionDenied
+	}
+
+	path := chunkPath(uuid, r.URL.Path)
+	if err := d.user.Fs.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return errToStatus(err), err
+	}
+
+	current, err := chunkOffset(d.user.Fs, path)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if offset != current {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(current, 10))
+		return http.StatusConflict, nil
+	}
+
+	file, err := d.user.Fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	// the part of the chunk received before an error is kept
+	n, err := io.Copy(file, r.Body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset+n, 10))
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+})
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// testServer serves the handlers to the users of a bolt storage, each
+// user has its own directory under the root.
+type testServer struct {
+	t      *testing.T
+	store  *storage.Storage
+	server *settings.Server
+	key    []byte
+}
+
+func newTestServer(t *testing.T, staging bool) *testServer {
+	db, err := storm.Open(filepath.Join(t.TempDir(), "database.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store, err := bolt.NewStorage(db)
+	require.NoError(t, err)
+
+	set := &settings.Settings{Key: []byte("key")}
+	set.Reload.Staging = staging
+	require.NoError(t, set.Reload.Clean())
+	require.NoError(t, set.Validation.Clean())
+	require.NoError(t, store.Settings.Save(set))
+
+	// every user has its own scope, but the admin sees them all
+	for _, u := range []*users.User{
+		{ID: 1, Username: "owner", Scope: "owner", Perm: users.Permissions{Create: true, Modify: true}},
+		{ID: 2, Username: "other", Scope: "other", Perm: users.Permissions{Create: true, Modify: true}},
+		{ID: 3, Username: "admin", Scope: ".", Perm: users.Permissions{Admin: true, Create: true, Modify: true}},
+		{ID: 4, Username: "approver", Scope: "approver", Perm: users.Permissions{Approve: true}},
+	} {
+		u.Password = "password"
+		require.NoError(t, store.Users.Save(u))
+	}
+	return &testServer{t: t, store: store, server: &settings.Server{Root: t.TempDir()}, key: set.Key}
+}
+
+// write creates the file at path, relative to the root.
+func (s *testServer) write(path, content string) {
+	full := filepath.Join(s.server.Root, path)
+	require.NoError(s.t, os.MkdirAll(filepath.Dir(full), 0775))
+	require.NoError(s.t, ioutil.WriteFile(full, []byte(content), 0644))
+}
+
+// do serves the request of the user to the handler under prefix.
+func (s *testServer) do(fn handleFunc, prefix string, userID uint, method, target string, body io.Reader) *httptest.ResponseRecorder {
+	claims := &authToken{
+		User: userInfo{ID: userID},
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(TokenExpirationTime).Unix(),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.key)
+	require.NoError(s.t, err)
+
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set("X-Auth", signed)
+	w := httptest.NewRecorder()
+	handle(fn, prefix, s.store, s.server).ServeHTTP(w, r)
+	return w
+}
+
+func (s *testServer) read(path string) string {
+	b, err := ioutil.ReadFile(filepath.Join(s.server.Root, path))
+	require.NoError(s.t, err)
+	return string(b)
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheckUUID(t *testing.T) {
+	assert.NoError(t, checkUUID("0f8fad5b-d9cb-469f-a165-70867728950e"))
+	for _, uuid := range []string{"", "../../etc", "0f8fad5b-d9cb-469f-a165-70867728950e/..", "a", "0f8fad5bd9cb469fa16570867728950e"} {
+		assert.Error(t, checkUUID(uuid), uuid)
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	for _, staging := range []bool{false, true} {
+		t.Run(map[bool]string{false: "live", true: "staging"}[staging], func(t *testing.T) {
+			s := newTestServer(t, staging)
+			const uuid = "0f8fad5b-d9cb-469f-a165-70867728950e"
+			t.Cleanup(func() { cache.Del(uuid) })
+			chunks := "/api/chunks/ClientConfig/item.db?uuid=" + uuid
+			patch := func(userID uint, offset, body string) *httptest.ResponseRecorder {
+				return s.do(chunkPatchHandler, "/api/chunks", userID, "PATCH", chunks+"&offset="+offset, strings.NewReader(body))
+			}
+
+			w := s.do(chunkHeadHandler, "/api/chunks", 1, "HEAD", chunks, nil)
+			require.Equal(t, http.StatusNoContent, w.Code)
+			assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+
+			w = patch(1, "0", "hello ")
+			require.Equal(t, http.StatusNoContent, w.Code)
+			assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+			// a chunk sent again is refused with the offset to resume from
+			w = patch(1, "0", "hello ")
+			assert.Equal(t, http.StatusConflict, w.Code)
+			assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+
+			// the session and its chunks belong to the uploader
+			assert.Equal(t, http.StatusForbidden, patch(2, "6", "evil").Code)
+			assert.Equal(t, http.StatusForbidden, s.do(chunkHeadHandler, "/api/chunks", 2, "HEAD", chunks, nil).Code)
+			w = s.do(chunkHeadHandler, "/api/chunks", 3, "HEAD", chunks, nil)
+			assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+
+			require.Equal(t, http.StatusNoContent, patch(1, "6", "world").Code)
+
+			complete := "/api/resources/ClientConfig/item.db?override=true&dir=/ClientConfig&chunked=true&uuid=" + uuid
+			w = s.do(resourcePostPutHandler, "/api/resources", 1, "POST", complete+"&sha256="+sha256Hex("nope"), nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			// the chunks were consumed by the failed completion
+			require.Equal(t, http.StatusNoContent, patch(1, "0", "hello world").Code)
+
+			w = s.do(resourcePostPutHandler, "/api/resources", 1, "POST", complete+"&sha256="+sha256Hex("hello world"), nil)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			etag := w.Header().Get("ETag")
+			dst := "/ClientConfig/item.db"
+			if staging {
+				dst = stagePath(uuid, dst)
+			}
+			assert.Equal(t, "hello world", s.read(filepath.Join("owner", dst)))
+
+			// a completion retried after its response was lost succeeds again
+			w = s.do(resourcePostPutHandler, "/api/resources", 1, "POST", complete+"&sha256="+sha256Hex("hello world"), nil)
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+			w = s.do(resourcePostPutHandler, "/api/resources", 1, "POST", complete+"&sha256="+sha256Hex("other"), nil)
+			assert.NotEqual(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestUploadSessionChecks(t *testing.T) {
+	s := newTestServer(t, false)
+	const uuid = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	t.Cleanup(func() { cache.Del(uuid) })
+	upload := func(userID uint, uuid, content string) int {
+		target := "/api/resources/ClientConfig/a.db?override=true&dir=/ClientConfig&uuid=" + uuid
+		return s.do(resourcePostPutHandler, "/api/resources", userID, "POST", target, strings.NewReader(content)).Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, upload(1, "..%2F..%2Ftmp", "a"))
+	assert.Equal(t, http.StatusBadRequest, s.do(chunkHeadHandler, "/api/chunks", 1, "HEAD", "/api/chunks/a.db?uuid=x", nil).Code)
+	assert.Equal(t, http.StatusOK, upload(1, uuid, "a"))
+	assert.Equal(t, http.StatusForbidden, upload(2, uuid, "b"))
+	assert.Equal(t, "a", s.read("owner/ClientConfig/a.db"))
+
+	// an admin uploads in the scope of the uploader of the session
+	assert.Equal(t, http.StatusOK, upload(3, uuid, "c"))
+	assert.Equal(t, "c", s.read("owner/ClientConfig/a.db"))
+	_, err := os.Stat(filepath.Join(s.server.Root, "ClientConfig"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStagingHidden(t *testing.T) {
+	s := newTestServer(t, true)
+	const uuid = "1b4e28ba-2fa1-41d2-883f-0016d3cca427"
+	t.Cleanup(func() { cache.Del(uuid) })
+	target := "/api/resources/ClientConfig/a.db?override=true&dir=/ClientConfig&uuid=" + uuid
+	w := s.do(resourcePostPutHandler, "/api/resources", 1, "POST", target, strings.NewReader("a"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = s.do(resourceGetHandler, "/api/resources", 1, "GET", "/api/resources/", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), ".staging")
+	assert.Equal(t, http.StatusForbidden, s.do(resourceGetHandler, "/api/resources", 1, "GET", "/api/resources/.staging/"+uuid, nil).Code)
+
+	// the staged files can't be written around their session
+	staged := "/.staging/" + uuid + "/ClientConfig/a.db"
+	w = s.do(resourcePostPutHandler, "/api/resources", 1, "POST", "/api/resources"+staged+"?override=true&dir=/ClientConfig&uuid="+uuid, strings.NewReader("b"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = s.do(resourcePostPutHandler, "/api/resources", 1, "POST", "/api/resources/ClientConfig/b.db?override=true&dir=/.staging&uuid="+uuid, strings.NewReader("b"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = s.do(chunkPatchHandler, "/api/chunks", 1, "PATCH", "/api/chunks"+staged+"?offset=0&uuid="+uuid, strings.NewReader("b"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = s.do(resourcePatchHandler, "/api/resources", 1, "PATCH", "/api/resources/ClientConfig/x.db?action=copy&destination="+url.QueryEscape(staged), nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "a", s.read(filepath.Join("owner", staged)))
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+// uuidRe matches the uuids the clients generate for their sessions.
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-([0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}$`)
+
+// sessionsGetHandler lists the live upload sessions of the user, so that
+// an interrupted session can be resumed or rolled back. Admins and approvers
+// see all of them. They can be filtered by uuid and state, such as
+// "pending" for the sessions to review.
+var sessionsGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	uuid := r.URL.Query().Get("uuid")
+	state := session.State(r.URL.Query().Get("state"))
+	sessions := []*session.Session{}
+	for _, sess := range cache.Sessions() {
+		if !canSeeSession(d, sess) {
+			continue
+		}
+		if uuid != "" && sess.UUID != uuid {
+			continue
+		}
+		if state != "" && sess.State != state {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+
+	return renderJSON(w, r, sessions)
+})
+
+// canSeeSession tells whether the user may look at the session: its
+// uploader, an admin or an approver.
+func canSeeSession(d *data, sess *session.Session) bool {
+	return d.user.Perm.Admin || d.user.Perm.Approve || sess.UserID == d.user.ID
+}
+
+// sessionData returns d working on the files of the session. The paths of
+// a session are those of the scope of its uploader, which may differ from
+// the scope of the user of d, an admin for instance. The actions are still
+// done and recorded as the user of d.
+func sessionData(d *data, sess *session.Session) (*data, error) {
+	if sess.UserID == d.user.ID {
+		return d, nil
+	}
+	owner, err := d.store.Users.Get(d.server.Root, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := *d.user
+	user.Fs, user.Scope = owner.Fs, owner.Scope
+	sd := *d
+	sd.user = &user
+	return &sd, nil
+}
+
+// checkUUID fails if uuid is not a uuid. The uuid of an upload session
+// names its staging, chunk and backup paths, so it is checked before any
+// of them is built.
+func checkUUID(uuid string) error {
+	if !uuidRe.MatchString(uuid) {
+		return fmt.Errorf("invalid session uuid %q: %w", uuid, libErrors.ErrInvalidRequestParams)
+	}
+	return nil
+}
+
+// canUploadTo tells whether the user may upload in the session: it is a
+// new one, or its own, or the user is an admin.
+func canUploadTo(d *data, uuid string) bool {
+	sess, found := cache.Session(uuid)
+	return !found || d.user.Perm.Admin || sess.UserID == d.user.ID
+}
+
+// uploadData returns d uploading in the session, in the scope of its
+// uploader once the session is open.
+func uploadData(d *data, uuid string) (*data, error) {
+	sess, found := cache.Session(uuid)
+	if !found {
+		return d, nil
+	}
+	return sessionData(d, sess)
+}
+
+// openSession opens the upload session of the user unless it is open
+// already. It returns false if too many sessions are open.
+func openSession(d *data, uuid string) bool {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if cache.IsKeyExisted(uuid) {
+		return true
+	}
+	// upload all files within one hour
+	return cache.Set(uuid, d.user.ID, make(map[string]*CacheData), duration)
+}
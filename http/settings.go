@@ -16,6 +16,8 @@ type settingsData struct {
 	Branding      settings.Branding     `json:"branding"`
 	Shell         []string              `json:"shell"`
 	Commands      map[string][]string   `json:"commands"`
+	Reload        settings.Reload       `json:"reload"`
+	Validation    *settings.Validation  `json:"validation"`
 }
 
 var settingsGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
@@ -27,6 +29,8 @@ var settingsGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request,
 		Branding:      d.settings.Branding,
 		Shell:         d.settings.Shell,
 		Commands:      d.settings.Commands,
+		Reload:        d.settings.Reload,
+		Validation:    &d.settings.Validation,
 	}
 
 	return renderJSON(w, r, data)
@@ -46,6 +50,13 @@ var settingsPutHandler = withAdmin(func(w http.ResponseWriter, r *http.Request,
 	d.settings.Branding = req.Branding
 	d.settings.Shell = req.Shell
 	d.settings.Commands = req.Commands
+	// keep the reload settings of clients which do not know them
+	if req.Reload.ProcMap != nil {
+		d.settings.Reload = req.Reload
+	}
+	if req.Validation != nil {
+		d.settings.Validation = *req.Validation
+	}
 
 	err = d.store.Settings.Save(d.settings)
 	return errToStatus(err), err
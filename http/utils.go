@@ -49,12 +49,14 @@ func errToStatus(err error) int {
 		return http.StatusForbidden
 	case os.IsNotExist(err), err == libErrors.ErrNotExist:
 		return http.StatusNotFound
-	case os.IsExist(err), err == libErrors.ErrExist:
+	case os.IsExist(err), err == libErrors.ErrExist, err == libErrors.ErrSessionConflict:
 		return http.StatusConflict
 	case errors.Is(err, libErrors.ErrPermissionDenied):
 		return http.StatusForbidden
 	case errors.Is(err, libErrors.ErrInvalidRequestParams):
 		return http.StatusBadRequest
+	case errors.Is(err, libErrors.ErrInvalidConfig):
+		return http.StatusUnprocessableEntity
 	default:
 		return http.StatusInternalServerError
 	}
@@ -0,0 +1,16 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/filebrowser/filebrowser/v2/version"
+)
+
+// versionHandler tells the version of the server, e.g. to check the nodes
+// of an environment.
+var versionHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return renderJSON(w, r, map[string]string{
+		"version":   version.Version,
+		"commitSHA": version.CommitSHA,
+	})
+})
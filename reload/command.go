@@ -0,0 +1,117 @@
+package reload
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// Shell reloads with the console_cmd.sh script of TCM.
+type Shell struct {
+	Dir     string
+	Timeout time.Duration
+}
+
+// Reload implements Reloader.
+func (s *Shell) Reload(proc string, l Listener) (*Report, error) {
+	return runCommand(s.Dir, s.Timeout, []string{"sh", "console_cmd.sh", "reload " + proc}, l)
+}
+
+// Command reloads with a command template, in which "{proc}" is
+// replaced by the proc expression.
+type Command struct {
+	Template []string
+	Dir      string
+	Timeout  time.Duration
+}
+
+// Reload implements Reloader.
+func (c *Command) Reload(proc string, l Listener) (*Report, error) {
+	if len(c.Template) == 0 {
+		return nil, errors.ErrEmptyRequest
+	}
+
+	args := make([]string, len(c.Template))
+	for i, arg := range c.Template {
+		args[i] = strings.ReplaceAll(arg, "{proc}", proc)
+	}
+
+	return runCommand(c.Dir, c.Timeout, args, l)
+}
+
+func runCommand(dir string, timeout time.Duration, args []string, l Listener) (*Report, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Dir = dir
+
+	report := &Report{}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		report.Lines = []string{"Get StdoutPipe failed for " + err.Error()}
+		return report, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		report.Lines = []string{"Get StderrPipe failed for " + err.Error()}
+		return report, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		report.Lines = []string{"Start command failed for " + err.Error()}
+		return report, err
+	}
+
+	// both pipes are read at once, so that the errors are streamed as they
+	// come and the command never blocks on a full pipe
+	lines := make(chan string)
+	var wg sync.WaitGroup
+	for _, pipe := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func(pipe io.Reader) {
+			defer wg.Done()
+			s := bufio.NewScanner(pipe)
+			for s.Scan() {
+				lines <- s.Text()
+			}
+			// the rest of a pipe with a too long line
+			_, _ = io.Copy(ioutil.Discard, pipe)
+		}(pipe)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	for line := range lines {
+		log.Println(line)
+		l.notify(&Event{Type: EventLine, Line: line})
+		// only keep the lines of the results
+		if res := ParseLine(line); res != nil {
+			report.Lines = append(report.Lines, res.Msg)
+			report.Results = append(report.Results, res)
+			l.notify(&Event{Type: EventResult, Result: res})
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		log.Printf("Command execution failed for %s", err.Error())
+		return report, err
+	}
+	return report, nil
+}
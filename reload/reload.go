@@ -0,0 +1,124 @@
+package reload
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// Status is the outcome of the reload of a process.
+type Status string
+
+const (
+	StatusSucceed Status = "succeed"
+	StatusFailed  Status = "failed"
+)
+
+// Result is the outcome of the reload of one process.
+type Result struct {
+	Proc   string `json:"proc"`
+	Status Status `json:"status"`
+	Msg    string `json:"msg"`
+}
+
+// Report is the outcome of a reload.
+type Report struct {
+	Lines   []string  `json:"lines"`
+	Results []*Result `json:"results"`
+}
+
+// Failed returns the results of the processes which failed to reload.
+func (r *Report) Failed() []*Result {
+	var failed []*Result
+	for _, res := range r.Results {
+		if res.Status == StatusFailed {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// EventType is the type of a reload event.
+type EventType string
+
+const (
+	// EventLine is an output line of the reload.
+	EventLine EventType = "line"
+	// EventResult is the outcome of the reload of a process.
+	EventResult EventType = "result"
+	// EventDone ends the reload.
+	EventDone EventType = "done"
+)
+
+// Event notifies the progress of a reload.
+type Event struct {
+	Type   EventType `json:"type"`
+	Line   string    `json:"line,omitempty"`
+	Result *Result   `json:"result,omitempty"`
+	// Status and Error are only set for EventDone.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Listener is notified of the events of a reload as they happen.
+type Listener func(*Event)
+
+func (l Listener) notify(e *Event) {
+	if l != nil {
+		l(e)
+	}
+}
+
+// Reloader reloads the configs of the processes matching a proc
+// expression such as "*.*.[13,17].*". The listener may be nil.
+type Reloader interface {
+	Reload(proc string, l Listener) (*Report, error)
+}
+
+// New creates the reloader described by the settings. Relative working
+// directories are resolved against root.
+func New(b settings.ReloadBackend, root string) (Reloader, error) {
+	dir := b.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	timeout := time.Duration(b.Timeout) * time.Second
+
+	switch b.Type {
+	case settings.ReloadBackendShell, "":
+		return &Shell{Dir: dir, Timeout: timeout}, nil
+	case settings.ReloadBackendCommand:
+		return &Command{Template: b.Command, Dir: dir, Timeout: timeout}, nil
+	case settings.ReloadBackendWebhook:
+		return &Webhook{URL: b.URL, Headers: b.Headers, Timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("unknown reload backend %q: %w", b.Type, errors.ErrInvalidOption)
+	}
+}
+
+var (
+	resultRegexp = regexp.MustCompile(`(?i)^(.*)\[(failed|succeed)\]$`)
+	procRegexp   = regexp.MustCompile(`\d+\.\d+\.\d+\.\d+`)
+)
+
+// ParseLine extracts the result of a process from a line printed by a
+// reload script, such as "reload 1.1.13.1 [succeed]". It returns nil if
+// the line does not report a result.
+func ParseLine(line string) *Result {
+	line = strings.TrimSpace(line)
+	match := resultRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+
+	return &Result{
+		Proc:   procRegexp.FindString(match[1]),
+		Status: Status(strings.ToLower(match[2])),
+		Msg:    line,
+	}
+}
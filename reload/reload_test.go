@@ -0,0 +1,83 @@
+package reload
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestParseLine(t *testing.T) {
+	res := ParseLine("  reload 1.1.13.1 GameSvr [succeed] ")
+	require.NotNil(t, res)
+	assert.Equal(t, "1.1.13.1", res.Proc)
+	assert.Equal(t, StatusSucceed, res.Status)
+	assert.Equal(t, "reload 1.1.13.1 GameSvr [succeed]", res.Msg)
+
+	res = ParseLine("reload 1.1.17.2 MatchSvr [FAILED]")
+	require.NotNil(t, res)
+	assert.Equal(t, StatusFailed, res.Status)
+
+	assert.Nil(t, ParseLine("connecting to tconnd"))
+}
+
+func TestCommand(t *testing.T) {
+	c := &Command{Template: []string{"sh", "-c", "echo start; echo 'reload {proc} [succeed]'"}}
+	var events []*Event
+	report, err := c.Reload("1.1.13.1", func(e *Event) { events = append(events, e) })
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "start", events[0].Line)
+	assert.Equal(t, EventResult, events[2].Type)
+	assert.Equal(t, []string{"reload 1.1.13.1 [succeed]"}, report.Lines)
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, "1.1.13.1", report.Results[0].Proc)
+	assert.Empty(t, report.Failed())
+}
+
+func TestCommandStderr(t *testing.T) {
+	// more errors than a pipe holds before the result on stdout
+	c := &Command{
+		Template: []string{"sh", "-c", `echo first error >&2; sleep 0.2; echo 'reload {proc} [succeed]'
+i=0; while [ $i -lt 1500 ]; do echo "error line $i, long enough to fill the pipe quickly" >&2; i=$((i+1)); done; echo 'reload {proc} [FAILED]'`},
+		Timeout: 10 * time.Second,
+	}
+	var events []*Event
+	report, err := c.Reload("1.1.13.1", func(e *Event) { events = append(events, e) })
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	assert.Equal(t, "first error", events[0].Line)
+	assert.Len(t, events, 1505)
+	require.Len(t, report.Results, 2)
+	assert.Len(t, report.Failed(), 1)
+}
+
+func TestWebhook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		req := &webhookRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		_ = json.NewEncoder(w).Encode(&Report{
+			Results: []*Result{{Proc: req.Proc, Status: StatusFailed, Msg: "timeout"}},
+		})
+	}))
+	defer srv.Close()
+
+	r, err := New(settings.ReloadBackend{
+		Type:    settings.ReloadBackendWebhook,
+		URL:     srv.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+	}, "")
+	require.NoError(t, err)
+
+	report, err := r.Reload("*.*.13.*", nil)
+	require.NoError(t, err)
+	require.Len(t, report.Failed(), 1)
+	assert.Equal(t, "*.*.13.*", report.Failed()[0].Proc)
+}
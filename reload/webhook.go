@@ -0,0 +1,64 @@
+package reload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook reloads by posting the proc expression to an HTTP endpoint:
+//
+//	{"proc": "*.*.[13,17].*"}
+//
+// which answers with a Report as JSON. The events are only notified once
+// the webhook answered.
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+type webhookRequest struct {
+	Proc string `json:"proc"`
+}
+
+// Reload implements Reloader.
+func (h *Webhook) Reload(proc string, l Listener) (*Report, error) {
+	body, err := json.Marshal(&webhookRequest{Proc: proc})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: h.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &Report{Lines: []string{err.Error()}}, err
+	}
+	defer resp.Body.Close()
+
+	report := &Report{}
+	err = json.NewDecoder(resp.Body).Decode(report)
+	for _, line := range report.Lines {
+		l.notify(&Event{Type: EventLine, Line: line})
+	}
+	for _, res := range report.Results {
+		l.notify(&Event{Type: EventResult, Result: res})
+	}
+	// failed reloads may still come with a report
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return report, fmt.Errorf("reload webhook answered %s", resp.Status)
+	}
+
+	return report, err
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"time"
+)
+
+// State describes the lifecycle of a session.
+type State string
+
+const (
+	// StateOpen is a session still receiving uploads.
+	StateOpen State = "open"
+	// StateReloaded is a session whose configs have been reloaded. It is
+	// kept until it expires so that it can still be rolled back.
+	StateReloaded State = "reloaded"
+	// StateCanary is a session whose configs have only been reloaded by
+	// the canary instances, waiting to be promoted to the others or aborted.
+	StateCanary State = "canary"
+	// StatePending is a session waiting for approval, its uploads are
+	// reviewed before it can be reloaded.
+	StatePending State = "pending"
+	// StateApproved is a session approved for reload.
+	StateApproved State = "approved"
+	// StateRejected is a session whose review failed, it can be approved
+	// again once new files are uploaded.
+	StateRejected State = "rejected"
+)
+
+// Dir holds the files uploaded to a directory during a session.
+type Dir struct {
+	BakDir  string   `json:"bakdir"`
+	Files   []string `json:"files"`
+	Created []string `json:"created"`
+	XMLs    []string `json:"xmls"`
+	DBs     []string `json:"dbs"`
+	Svrs    []string `json:"svrs"`
+}
+
+// Canary is the canary of a session waiting for promotion.
+type Canary struct {
+	Inst    string `json:"inst"`    // the instance reloaded first, e.g. "1" or "[1,2]"
+	Promote int64  `json:"promote"` // when the others are reloaded in unix seconds, 0 to wait for the promotion
+}
+
+// Session is an upload/reload session, identified by the uuid the
+// uploader sends along with its requests.
+type Session struct {
+	UUID   string          `json:"uuid" storm:"id"`
+	UserID uint            `json:"userID" storm:"index"`
+	State  State           `json:"state"`
+	Start  int64           `json:"start"` // when the session was opened, in nanoseconds
+	Expire int64           `json:"expire"`
+	Dirs   map[string]*Dir `json:"dirs"`
+	Canary *Canary         `json:"canary,omitempty"`
+	// Approved maps the files of an approved session to the sha256 of
+	// the versions its reviewer approved.
+	Approved map[string]string `json:"approved,omitempty"`
+}
+
+// Expired checks if the session is no longer valid.
+func (s *Session) Expired() bool {
+	return s.Expire <= time.Now().Unix()
+}
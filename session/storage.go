@@ -0,0 +1,56 @@
+package session
+
+import (
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// StorageBackend is the interface to implement for a session storage.
+type StorageBackend interface {
+	Get(uuid string) (*Session, error)
+	Gets() ([]*Session, error)
+	Save(s *Session) error
+	Delete(uuid string) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a session storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// Get wraps a StorageBackend.Get and deletes the session if it has expired.
+func (s *Storage) Get(uuid string) (*Session, error) {
+	sess, err := s.back.Get(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if sess.Expired() {
+		if err := s.Delete(sess.UUID); err != nil {
+			return nil, err
+		}
+		return nil, errors.ErrNotExist
+	}
+
+	return sess, nil
+}
+
+// Gets wraps a StorageBackend.Gets. The expired sessions are returned too,
+// so that what they left behind is cleaned up when they are deleted.
+func (s *Storage) Gets() ([]*Session, error) {
+	return s.back.Gets()
+}
+
+// Save wraps a StorageBackend.Save
+func (s *Storage) Save(sess *Session) error {
+	return s.back.Save(sess)
+}
+
+// Delete wraps a StorageBackend.Delete
+func (s *Storage) Delete(uuid string) error {
+	return s.back.Delete(uuid)
+}
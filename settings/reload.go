@@ -0,0 +1,212 @@
+package settings
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// Reload contains the settings of the hot reload of configs.
+type Reload struct {
+	// ProcMap maps the server names of SvrLoadList.xml to proc IDs
+	// such as "*.*.13.*". An empty proc ID explicitly skips the server.
+	ProcMap map[string]string `json:"procMap"`
+	// Backend is the way the processes are told to reload.
+	Backend ReloadBackend `json:"backend"`
+	// Staging keeps the uploads of a session out of the live tree until
+	// the session is committed, by a reload or explicitly. The commit
+	// swaps the directories atomically, which requires Linux.
+	Staging bool `json:"staging"`
+	// After maps a server name of ProcMap to the servers which must be
+	// reloaded before it. The targeted processes are reloaded in waves
+	// following this order, all at once if it is empty.
+	After map[string][]string `json:"after"`
+	// HealthCheck is run in the backend dir between two waves, "{proc}"
+	// being replaced by the proc expression of the wave which is over.
+	// The next wave starts once it exits with 0.
+	HealthCheck []string `json:"healthCheck"`
+	// Rollback rolls the session back and reloads the waves done when a
+	// wave reports failed processes or its health check fails. It is
+	// enabled unless set to false.
+	Rollback *bool `json:"rollback,omitempty"`
+	// RequireApproval only reloads or commits the sessions approved by a
+	// user with the approve permission other than their uploader. An
+	// upload sends an approved session back to review. It requires Staging,
+	// so that the uploads stay out of the live files until they are approved.
+	RequireApproval bool `json:"requireApproval"`
+}
+
+// Reload backend types.
+const (
+	ReloadBackendShell   = "shell"
+	ReloadBackendCommand = "command"
+	ReloadBackendWebhook = "webhook"
+)
+
+// DefaultReloadDir is the working directory of the console_cmd.sh
+// script of TCM, relative to the user scope.
+const DefaultReloadDir = "apps/tcm/bin"
+
+// ReloadBackend describes how the processes are reloaded.
+type ReloadBackend struct {
+	// Type is one of "shell" (console_cmd.sh), "command" or "webhook".
+	Type string `json:"type"`
+	// Dir is the working directory of the shell and command backends,
+	// relative to the user scope unless absolute.
+	Dir string `json:"dir"`
+	// Command is the command of the command backend, in which "{proc}"
+	// is replaced by the proc expression.
+	Command []string `json:"command"`
+	// URL and Headers are used by the webhook backend.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Timeout of a reload in seconds, 0 means no timeout.
+	Timeout int `json:"timeout"`
+}
+
+// Clean sets the defaults of the backend and validates it.
+func (b *ReloadBackend) Clean() error {
+	if b.Type == "" {
+		b.Type = ReloadBackendShell
+	}
+	if b.Dir == "" {
+		b.Dir = DefaultReloadDir
+	}
+	if b.Timeout < 0 {
+		return fmt.Errorf("negative reload timeout: %w", errors.ErrInvalidRequestParams)
+	}
+
+	switch b.Type {
+	case ReloadBackendShell:
+	case ReloadBackendCommand:
+		if len(b.Command) == 0 {
+			return fmt.Errorf("the command reload backend needs a command: %w", errors.ErrInvalidRequestParams)
+		}
+	case ReloadBackendWebhook:
+		if b.URL == "" {
+			return fmt.Errorf("the webhook reload backend needs an url: %w", errors.ErrInvalidRequestParams)
+		}
+	default:
+		return fmt.Errorf("unknown reload backend %q: %w", b.Type, errors.ErrInvalidRequestParams)
+	}
+
+	return nil
+}
+
+// DefaultProcMap returns the server name to proc ID mapping used
+// when none has been configured.
+func DefaultProcMap() map[string]string {
+	return map[string]string{
+		"Common":         "*.*.*.*",
+		"GameSvr":        "*.*.13.*",
+		"MatchSvr":       "*.*.17.*",
+		"PvpAgentSvr":    "*.*.16.*",
+		"ChatSvr":        "*.*.20.*",
+		"ViewSvr":        "*.*.34.*",
+		"TeamSvr":        "*.*.19.*",
+		"ActivitySvr":    "*.*.39.*",
+		"WeeklyFubenSvr": "*.*.40.*",
+		"MonitorSvr":     "",
+	}
+}
+
+var procIDRegexp = regexp.MustCompile(`^(\*|\d+)\.(\*|\d+)\.(\*|\d+)\.(\*|\d+)$`)
+
+// ValidateProcID checks that a proc ID has the "world.zone.func.inst"
+// form, where each part is either a number or "*".
+func ValidateProcID(id string) error {
+	if !procIDRegexp.MatchString(id) {
+		return fmt.Errorf("invalid proc id %q: %w", id, errors.ErrInvalidRequestParams)
+	}
+	return nil
+}
+
+// Clean sets the defaults of the reload settings and validates them.
+func (r *Reload) Clean() error {
+	if r.ProcMap == nil {
+		r.ProcMap = DefaultProcMap()
+	}
+
+	if err := r.Backend.Clean(); err != nil {
+		return err
+	}
+	if r.Staging && !stagingSupported {
+		return fmt.Errorf("staging is not supported on this platform: %w", errors.ErrInvalidRequestParams)
+	}
+	if r.RequireApproval && !r.Staging {
+		return fmt.Errorf("requiring approval needs staging: %w", errors.ErrInvalidRequestParams)
+	}
+
+	for name, id := range r.ProcMap {
+		if name == "" {
+			return fmt.Errorf("empty server name: %w", errors.ErrInvalidRequestParams)
+		}
+		if id == "" {
+			continue
+		}
+		if err := ValidateProcID(id); err != nil {
+			return fmt.Errorf("server %s: %w", name, err)
+		}
+	}
+
+	for name, deps := range r.After {
+		if _, ok := r.ProcMap[name]; !ok {
+			return fmt.Errorf("server %s is not mapped to a proc id: %w", name, errors.ErrInvalidRequestParams)
+		}
+		for _, dep := range deps {
+			if _, ok := r.ProcMap[dep]; !ok {
+				return fmt.Errorf("server %s reloaded before %s is not mapped to a proc id: %w",
+					dep, name, errors.ErrInvalidRequestParams)
+			}
+		}
+	}
+	if _, err := r.Levels(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RollbackEnabled tells whether a failed reload is rolled back.
+func (r *Reload) RollbackEnabled() bool {
+	return r.Rollback == nil || *r.Rollback
+}
+
+// Levels returns the wave of each server of ProcMap, starting at 0: a
+// server is reloaded in the wave following the last of the servers it is
+// reloaded after. It fails if the order has a cycle.
+func (r *Reload) Levels() (map[string]int, error) {
+	levels := make(map[string]int, len(r.ProcMap))
+	visiting := map[string]bool{}
+
+	var level func(name string) (int, error)
+	level = func(name string) (int, error) {
+		if l, ok := levels[name]; ok {
+			return l, nil
+		}
+		if visiting[name] {
+			return 0, fmt.Errorf("the reload order has a cycle through server %s: %w", name, errors.ErrInvalidRequestParams)
+		}
+		visiting[name] = true
+		l := 0
+		for _, dep := range r.After[name] {
+			dl, err := level(dep)
+			if err != nil {
+				return 0, err
+			}
+			if dl+1 > l {
+				l = dl + 1
+			}
+		}
+		levels[name] = l
+		return l, nil
+	}
+
+	for name := range r.ProcMap {
+		if _, err := level(name); err != nil {
+			return nil, err
+		}
+	}
+	return levels, nil
+}
@@ -0,0 +1,5 @@
+package settings
+
+// stagingSupported tells whether the directories can be swapped atomically
+// to commit the staged uploads.
+const stagingSupported = true
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package settings
+
+// stagingSupported tells whether the directories can be swapped atomically
+// to commit the staged uploads, which only Linux supports.
+const stagingSupported = false
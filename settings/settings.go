@@ -21,6 +21,8 @@ type Settings struct {
 	Commands      map[string][]string `json:"commands"`
 	Shell         []string            `json:"shell"`
 	Rules         []rules.Rule        `json:"rules"`
+	Reload        Reload              `json:"reload"`
+	Validation    Validation          `json:"validation"`
 }
 
 // GetRules implements rules.Provider.
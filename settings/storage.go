@@ -26,7 +26,26 @@ func NewStorage(back StorageBackend) *Storage {
 
 // Get returns the settings for the current instance.
 func (s *Storage) Get() (*Settings, error) {
-	return s.back.Get()
+	set, err := s.back.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	// databases created before the reload settings existed
+	if set.Reload.ProcMap == nil {
+		set.Reload.ProcMap = DefaultProcMap()
+	}
+	if set.Reload.Backend.Type == "" {
+		set.Reload.Backend.Type = ReloadBackendShell
+	}
+	if set.Reload.Backend.Dir == "" {
+		set.Reload.Backend.Dir = DefaultReloadDir
+	}
+	if set.Validation.Commands == nil {
+		set.Validation.Commands = map[string][]string{}
+	}
+
+	return set, nil
 }
 
 var defaultEvents = []string{
@@ -67,6 +86,14 @@ func (s *Storage) Save(set *Settings) error {
 		set.Commands = map[string][]string{}
 	}
 
+	if err := set.Reload.Clean(); err != nil {
+		return err
+	}
+
+	if err := set.Validation.Clean(); err != nil {
+		return err
+	}
+
 	for _, event := range defaultEvents {
 		if _, ok := set.Commands["before_"+event]; !ok {
 			set.Commands["before_"+event] = []string{}
@@ -0,0 +1,41 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// Validation contains the checks of the uploaded config files, which are
+// run before they replace the live ones.
+type Validation struct {
+	// DisableXML disables the well-formedness check of .xml files.
+	DisableXML bool `json:"disableXML"`
+	// SQLite is the sqlite3 binary checking the integrity of .db files.
+	// The check is disabled if it is empty, which is the default: the
+	// binary is not installed everywhere.
+	SQLite string `json:"sqlite"`
+	// Commands maps file extensions such as ".db" to validator commands,
+	// in which "{file}" is replaced by the uploaded file. A file is valid
+	// if the command exits with 0.
+	Commands map[string][]string `json:"commands"`
+}
+
+// Clean sets the defaults of the validation settings and validates them.
+func (v *Validation) Clean() error {
+	if v.Commands == nil {
+		v.Commands = map[string][]string{}
+	}
+
+	for ext, cmd := range v.Commands {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("validator extension %q must start with a dot: %w", ext, errors.ErrInvalidRequestParams)
+		}
+		if len(cmd) == 0 {
+			return fmt.Errorf("empty validator command for %s: %w", ext, errors.ErrInvalidRequestParams)
+		}
+	}
+
+	return nil
+}
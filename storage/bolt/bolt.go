@@ -4,6 +4,8 @@ import (
 	"github.com/asdine/storm"
 
 	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/history"
+	"github.com/filebrowser/filebrowser/v2/session"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/share"
 	"github.com/filebrowser/filebrowser/v2/storage"
@@ -16,6 +18,8 @@ func NewStorage(db *storm.DB) (*storage.Storage, error) {
 	shareStore := share.NewStorage(shareBackend{db: db})
 	settingsStore := settings.NewStorage(settingsBackend{db: db})
 	authStore := auth.NewStorage(authBackend{db: db}, userStore)
+	sessionStore := session.NewStorage(sessionBackend{db: db})
+	historyStore := history.NewStorage(historyBackend{db: db})
 
 	err := save(db, "version", 2)
 	if err != nil {
@@ -27,5 +31,7 @@ func NewStorage(db *storm.DB) (*storage.Storage, error) {
 		Users:    userStore,
 		Share:    shareStore,
 		Settings: settingsStore,
+		Sessions: sessionStore,
+		History:  historyStore,
 	}, nil
 }
@@ -0,0 +1,36 @@
+package bolt
+
+import (
+	"github.com/asdine/storm"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/history"
+)
+
+type historyBackend struct {
+	db *storm.DB
+}
+
+func (s historyBackend) Get(id int) (*history.Entry, error) {
+	var v history.Entry
+	err := s.db.One("ID", id, &v)
+	if err == storm.ErrNotFound {
+		return nil, errors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s historyBackend) Gets() ([]*history.Entry, error) {
+	var v []*history.Entry
+	err := s.db.All(&v)
+	if err == storm.ErrNotFound {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s historyBackend) Save(e *history.Entry) error {
+	return s.db.Save(e)
+}
@@ -0,0 +1,44 @@
+package bolt
+
+import (
+	"github.com/asdine/storm"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+type sessionBackend struct {
+	db *storm.DB
+}
+
+func (s sessionBackend) Get(uuid string) (*session.Session, error) {
+	var v session.Session
+	err := s.db.One("UUID", uuid, &v)
+	if err == storm.ErrNotFound {
+		return nil, errors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s sessionBackend) Gets() ([]*session.Session, error) {
+	var v []*session.Session
+	err := s.db.All(&v)
+	if err == storm.ErrNotFound {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s sessionBackend) Save(sess *session.Session) error {
+	return s.db.Save(sess)
+}
+
+func (s sessionBackend) Delete(uuid string) error {
+	err := s.db.DeleteStruct(&session.Session{UUID: uuid})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
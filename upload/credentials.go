@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	envUsername   = "UPLOAD_USERNAME"
+	envPassword   = "UPLOAD_PASSWORD"
+	envPassphrase = "UPLOAD_KEYSTORE_PASSPHRASE"
+
+	keystoreName = "keystore"
+	tokensName   = "tokens.gob"
+)
+
+// credential is the username and password of a node.
+type credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+var (
+	credMu sync.Mutex
+	// credentials entered at the prompt, by env
+	prompted = map[string]*credential{}
+)
+
+// configDir returns the per-user directory of the keystore and the token
+// cache, it is only accessible to the user.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "filebrowser-upload")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// envName returns the name of the environment variable of the env, e.g.
+// UPLOAD_DAILYBUILD_PASSWORD for the env dailybuild.
+func envName(env, name string) string {
+	env = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, env)
+	return strings.Replace(name, "UPLOAD_", "UPLOAD_"+env+"_", 1)
+}
+
+func lookupEnv(env, name string) string {
+	if v := os.Getenv(envName(env, name)); v != "" {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+// resolveCredentials fills the missing username and password of the node
+// from, in order, the environment variables, the keystore and the prompt.
+// The credentials in config.json are still used, but they are deprecated.
+func resolveCredentials(env string, so *Socket) error {
+	credMu.Lock()
+	defer credMu.Unlock()
+
+	if so.Password != "" {
+		log.Warningf("the password of %s is stored in plain text in %s", so.GetUrl(), configFile)
+		return nil
+	}
+
+	if so.Username == "" {
+		so.Username = lookupEnv(env, envUsername)
+	}
+	if so.Password = lookupEnv(env, envPassword); so.Password != "" && so.Username != "" {
+		return nil
+	}
+
+	if c, err := keystoreCredential(env, so.GetUrl()); err != nil {
+		return err
+	} else if c != nil {
+		if so.Username == "" {
+			so.Username = c.Username
+		}
+		so.Password = c.Password
+		return nil
+	}
+
+	c, err := promptCredential(env, so.Username)
+	if err != nil {
+		return err
+	}
+	if so.Username == "" {
+		so.Username = c.Username
+	}
+	so.Password = c.Password
+	return nil
+}
+
+// promptCredential asks for the credential of the env once, it is reused
+// for all the nodes of the env.
+func promptCredential(env, username string) (*credential, error) {
+	if c, found := prompted[env]; found {
+		return c, nil
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("no credential of env %s: set %s and %s, or save them in the keystore",
+			env, envName(env, envUsername), envName(env, envPassword))
+	}
+
+	c := &credential{Username: username}
+	if c.Username == "" {
+		fmt.Fprintf(os.Stderr, "username of %s: ", env)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		c.Username = strings.TrimSpace(line)
+	}
+	fmt.Fprintf(os.Stderr, "password of %s@%s: ", c.Username, env)
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	c.Password = string(password)
+
+	if saveCredentials {
+		if err := saveKeystoreCredential(env, c); err != nil {
+			return nil, err
+		}
+	}
+	prompted[env] = c
+	return c, nil
+}
+
+// keystore holds the credentials by env, or by env and url for the nodes
+// with their own credential.
+type keystore map[string]*credential
+
+// keystoreCredential returns the credential of the node, nil if the
+// keystore has none.
+func keystoreCredential(env, url string) (*credential, error) {
+	ks, _, err := openKeystore(false)
+	if err != nil || ks == nil {
+		return nil, err
+	}
+	if c, found := ks[env+"@"+url]; found {
+		return c, nil
+	}
+	return ks[env], nil
+}
+
+func saveKeystoreCredential(env string, c *credential) error {
+	ks, passphrase, err := openKeystore(true)
+	if err != nil {
+		return err
+	}
+	ks[env] = c
+	return writeKeystore(ks, passphrase)
+}
+
+var errWrongPassphrase = errors.New("wrong keystore passphrase")
+
+// openKeystore decrypts the keystore. If it does not exist, it returns nil
+// unless create is set.
+func openKeystore(create bool) (keystore, []byte, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, keystoreName))
+	if os.IsNotExist(err) {
+		if !create {
+			return nil, nil, nil
+		}
+		passphrase, err := keystorePassphrase()
+		return keystore{}, passphrase, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	passphrase, err := keystorePassphrase()
+	if err != nil {
+		return nil, nil, err
+	}
+	// salt | nonce | sealed json
+	if len(raw) < 16 {
+		return nil, nil, errWrongPassphrase
+	}
+	gcm, err := keystoreCipher(passphrase, raw[:16])
+	if err != nil {
+		return nil, nil, err
+	}
+	raw = raw[16:]
+	if len(raw) < gcm.NonceSize() {
+		return nil, nil, errWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, nil, errWrongPassphrase
+	}
+
+	ks := keystore{}
+	if err := json.Unmarshal(plain, &ks); err != nil {
+		return nil, nil, err
+	}
+	return ks, passphrase, nil
+}
+
+func writeKeystore(ks keystore, passphrase []byte) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(ks)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	gcm, err := keystoreCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	raw := append(salt, gcm.Seal(nonce, nonce, plain, nil)...)
+	return ioutil.WriteFile(filepath.Join(dir, keystoreName), raw, 0600)
+}
+
+func keystoreCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var passphrase []byte
+
+// keystorePassphrase returns the passphrase of the keystore from the
+// environment, or asks for it once.
+func keystorePassphrase() ([]byte, error) {
+	if passphrase != nil {
+		return passphrase, nil
+	}
+	if v := os.Getenv(envPassphrase); v != "" {
+		passphrase = []byte(v)
+		return passphrase, nil
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("the keystore is locked: set %s", envPassphrase)
+	}
+
+	fmt.Fprint(os.Stderr, "keystore passphrase: ")
+	p, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	passphrase = p
+	return passphrase, nil
+}
+
+// tokensPath returns the path of the token cache.
+func tokensPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, tokensName), nil
+}
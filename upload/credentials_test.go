@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setConfigDir moves the config dir of the test to a temporary one, with
+// the keystore unlocked by secret.
+func setConfigDir(t *testing.T, secret string) string {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv(envPassphrase, secret)
+	passphrase = nil
+	t.Cleanup(func() { passphrase = nil })
+	return dir
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	setConfigDir(t, "secret")
+
+	c, err := keystoreCredential("dev", "http://node:8080")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	require.NoError(t, saveKeystoreCredential("dev", &credential{Username: "admin", Password: "pass"}))
+	require.NoError(t, saveKeystoreCredential("prod", &credential{Username: "ops", Password: "word"}))
+
+	dir, err := configDir()
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, keystoreName))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	raw, err := ioutil.ReadFile(filepath.Join(dir, keystoreName))
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "pass")
+
+	c, err = keystoreCredential("dev", "http://node:8080")
+	require.NoError(t, err)
+	assert.Equal(t, &credential{Username: "admin", Password: "pass"}, c)
+	c, err = keystoreCredential("prod", "http://node:8080")
+	require.NoError(t, err)
+	assert.Equal(t, &credential{Username: "ops", Password: "word"}, c)
+
+	// a node can have its own credential
+	ks, secret, err := openKeystore(false)
+	require.NoError(t, err)
+	ks["dev@http://other:8080"] = &credential{Username: "other", Password: "other"}
+	require.NoError(t, writeKeystore(ks, secret))
+	c, err = keystoreCredential("dev", "http://other:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "other", c.Username)
+
+	passphrase = []byte("wrong")
+	_, err = keystoreCredential("dev", "http://node:8080")
+	assert.Equal(t, errWrongPassphrase, err)
+}
+
+func TestResolveCredentials(t *testing.T) {
+	setConfigDir(t, "secret")
+	require.NoError(t, saveKeystoreCredential("dev", &credential{Username: "admin", Password: "stored"}))
+
+	// the variables of the env come before the generic ones and the keystore
+	t.Setenv(envPassword, "generic")
+	t.Setenv("UPLOAD_DEV_USERNAME", "dev")
+	t.Setenv("UPLOAD_DEV_PASSWORD", "dev-pass")
+	so := &Socket{IP: "node", Port: 8080}
+	require.NoError(t, resolveCredentials("dev", so))
+	assert.Equal(t, "dev", so.Username)
+	assert.Equal(t, "dev-pass", so.Password)
+
+	// the keystore comes before the prompt
+	t.Setenv(envPassword, "")
+	t.Setenv("UPLOAD_DEV_PASSWORD", "")
+	so = &Socket{IP: "node", Port: 8080, Username: "me"}
+	require.NoError(t, resolveCredentials("dev", so))
+	assert.Equal(t, "me", so.Username)
+	assert.Equal(t, "stored", so.Password)
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), tokensName)
+	st := NewStore(path)
+	st.SetJwt("dev", "http://node:8080", "jwt")
+	st.SetUuid("dev", "http://node:8080", "uuid")
+	st.SetLastUuid("prod", "http://node:8080", "last")
+	require.NoError(t, st.Save())
+	require.NoError(t, st.file.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	st = NewStore(path)
+	defer st.file.Close()
+	assert.Equal(t, "jwt", st.GetJwt("dev", "http://node:8080"))
+	assert.Equal(t, "uuid", st.GetUuid("dev", "http://node:8080"))
+	assert.Equal(t, "last", st.GetLastUuid("prod", "http://node:8080"))
+
+	// logout forgets the jwts but keeps the sessions to roll back
+	assert.Equal(t, 1, st.Logout("dev"))
+	assert.Empty(t, st.GetJwt("dev", "http://node:8080"))
+	assert.Equal(t, "uuid", st.GetUuid("dev", "http://node:8080"))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/diff"
+)
+
+// sessionDiff is the response of /api/reload/diff.
+type sessionDiff struct {
+	UUID  string      `json:"uuid"`
+	Files []*fileDiff `json:"files"`
+}
+
+type fileDiff struct {
+	File   string        `json:"file"`
+	Kind   diff.Kind     `json:"kind"`
+	Tables []*diff.Table `json:"tables"`
+	XML    *diff.XMLDiff `json:"xml"`
+	Error  string        `json:"error"`
+}
+
+var kindSigns = map[diff.Kind]string{
+	diff.Added:    "A",
+	diff.Removed:  "D",
+	diff.Modified: "M",
+	"":            "=",
+}
+
+// print the changes of the files of the session against their versions
+// before it
+func isDiffCompleted(env string, st *Store, tcm *Socket) bool {
+	jwt := st.GetJwt(env, tcm.GetUrl())
+	uid := st.GetUuid(env, tcm.GetUrl())
+	status, body, err := tcm.diff(uid, jwt)
+	if err != nil {
+		log.Errorf("diff %s failed: %v", tcm.GetUrl(), err)
+		return false
+	}
+	if status != 200 {
+		log.Errorf("diff status: %d", status)
+		log.Errorf("diff result: %s", body)
+		return false
+	}
+	if !isText() {
+		if json.Valid([]byte(body)) {
+			report.Diff = json.RawMessage(body)
+		}
+		return true
+	}
+
+	var res sessionDiff
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		log.Errorf("decode diff: %v", err)
+		return false
+	}
+	printSessionDiff(&res)
+	return true
+}
+
+func printSessionDiff(res *sessionDiff) {
+	if len(res.Files) == 0 {
+		fmt.Println("no file in the session")
+	}
+	for _, f := range res.Files {
+		fmt.Printf("%s %s\n", kindSigns[f.Kind], f.File)
+		if f.Error != "" {
+			fmt.Printf("    error: %s\n", f.Error)
+		}
+		for _, t := range f.Tables {
+			fmt.Printf("    table %s %s: %d added, %d removed, %d modified\n", t.Name, t.Kind, t.Added, t.Removed, t.Modified)
+			if len(t.AddedColumns) > 0 {
+				fmt.Printf("      added columns: %s\n", strings.Join(t.AddedColumns, ", "))
+			}
+			if len(t.RemovedColumns) > 0 {
+				fmt.Printf("      removed columns: %s\n", strings.Join(t.RemovedColumns, ", "))
+			}
+			for _, row := range t.Rows {
+				fmt.Printf("      %s %s\n", kindSigns[row.Kind], strings.TrimSpace(row.Key+"  "+changesString(row.Kind, row.Changes)))
+			}
+			if t.Truncated {
+				fmt.Printf("      ... %d more rows\n", t.Added+t.Removed+t.Modified-len(t.Rows))
+			}
+		}
+		if f.XML != nil {
+			for _, n := range f.XML.Nodes {
+				fmt.Printf("    %s %s\n", kindSigns[n.Kind], strings.TrimSpace(n.Path+"  "+changesString(n.Kind, n.Changes)))
+			}
+			if f.XML.Truncated {
+				fmt.Println("    ... more elements")
+			}
+		}
+	}
+}
+
+// changesString shows the fields of an added or removed row or element,
+// and the changed fields of a modified one.
+func changesString(kind diff.Kind, changes []*diff.Change) string {
+	fields := make([]string, 0, len(changes))
+	for _, c := range changes {
+		switch kind {
+		case diff.Added:
+			fields = append(fields, c.Field+"="+c.New)
+		case diff.Removed:
+			fields = append(fields, c.Field+"="+c.Old)
+		default:
+			fields = append(fields, fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New))
+		}
+	}
+	return strings.Join(fields, ", ")
+}
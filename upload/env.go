@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "manage the envs of the config file",
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the envs",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		mustLoadConfig()
+		names := make([]string, 0, len(svrMap))
+		for name := range svrMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Name\tTCM\tNodes\tDescription")
+		for _, name := range names {
+			svr := svrMap[name]
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", name, svr.Tcm.GetUrl(), len(svr.Nodes), svr.Desc)
+		}
+		w.Flush()
+	},
+}
+
+var envShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "print an env, without its passwords",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mustLoadConfig()
+		svr := mustGetEnv(args[0])
+		svr.Tcm.Password = maskPassword(svr.Tcm.Password)
+		nodes := make([]Socket, len(svr.Nodes))
+		for i, node := range svr.Nodes {
+			node.Password = maskPassword(node.Password)
+			nodes[i] = node
+		}
+		svr.Nodes = nodes
+
+		b, err := json.MarshalIndent(svr, "", "    ")
+		if err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitUsage)
+		}
+		fmt.Println(string(b))
+	},
+}
+
+var envAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "add an env to the config file",
+	Long: `add an env to the config file, whose nodes are given as host:port. The
+credentials are not stored, they are read from the environment, the keystore
+or the prompt when needed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// the config file is created by the first env
+		if configErr != nil && !errors.Is(configErr, os.ErrNotExist) {
+			log.Errorf("%v", configErr)
+			os.Exit(exitUsage)
+		}
+		name := args[0]
+		if _, found := svrMap[name]; found && !mustGetBool(cmd, "force") {
+			log.Errorf("env %s already exists, use --force to replace it", name)
+			os.Exit(exitUsage)
+		}
+
+		base := Socket{
+			Username: mustGetString(cmd, "username"),
+			Scheme:   mustGetString(cmd, "scheme"),
+			BaseURL:  mustGetString(cmd, "baseurl"),
+			CA:       mustGetString(cmd, "ca"),
+		}
+		tcm, err := parseSocket(base, mustGetString(cmd, "tcm"))
+		if err != nil {
+			log.Errorf("tcm: %v", err)
+			os.Exit(exitUsage)
+		}
+		svr := Server{Desc: mustGetString(cmd, "desc"), Tcm: tcm}
+		nodes, _ := cmd.Flags().GetStringArray("node")
+		if len(nodes) == 0 {
+			log.Errorf("an env needs at least one node")
+			os.Exit(exitUsage)
+		}
+		for _, addr := range nodes {
+			node, err := parseSocket(base, addr)
+			if err != nil {
+				log.Errorf("node: %v", err)
+				os.Exit(exitUsage)
+			}
+			svr.Nodes = append(svr.Nodes, node)
+		}
+		if err := svr.validate(); err != nil {
+			log.Errorf("env %s is invalid: %v", name, err)
+			os.Exit(exitUsage)
+		}
+
+		svrMap[name] = svr
+		if err := saveConfig(svrMap); err != nil {
+			log.Errorf("save config file %s failed: %v", configFile, err)
+			os.Exit(exitUsage)
+		}
+		fmt.Printf("env %s added to %s\n", name, configFile)
+	},
+}
+
+var envRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "remove an env from the config file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mustLoadConfig()
+		mustGetEnv(args[0])
+		delete(svrMap, args[0])
+		if err := saveConfig(svrMap); err != nil {
+			log.Errorf("save config file %s failed: %v", configFile, err)
+			os.Exit(exitUsage)
+		}
+		fmt.Printf("env %s removed from %s\n", args[0], configFile)
+	},
+}
+
+var envTestCmd = &cobra.Command{
+	Use:   "test <name>",
+	Short: "log in to the tcm and every node of an env and print their versions",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mustLoadConfig()
+		name := args[0]
+		svr := mustGetEnv(name)
+
+		sockets := append([]Socket{svr.Tcm}, svr.Nodes...)
+		versions := make([]string, len(sockets))
+		index := map[*Socket]int{}
+		for i := range sockets {
+			index[&sockets[i]] = i
+		}
+		// the results are in the order of the sockets, the tcm first
+		results := runNodes(sockets, workers, func() bool { return false }, func(so *Socket, res *nodeResult) error {
+			jwt, err := testLogin(name, so)
+			if err != nil {
+				return err
+			}
+			v, err := so.version(jwt)
+			if err != nil {
+				return fmt.Errorf("version: %v", err)
+			}
+			versions[index[so]] = v
+			return nil
+		})
+
+		failed := false
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Role\tNode\tStatus\tVersion\tDuration\tError")
+		for i, res := range results {
+			role := "node"
+			if i == 0 {
+				role = "tcm"
+			}
+			failed = failed || res.Status != nodeOK
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", role, res.Node.GetUrl(), res.Status, versions[i],
+				res.Duration.Round(time.Millisecond), res.Err)
+		}
+		w.Flush()
+		if failed {
+			os.Exit(exitLogin)
+		}
+	},
+}
+
+// testLogin logs in without caching the token, so that the credentials are
+// checked.
+func testLogin(env string, so *Socket) (string, error) {
+	if err := resolveCredentials(env, so); err != nil {
+		return "", err
+	}
+	status, body, err := so.login()
+	if err != nil {
+		return "", err
+	}
+	if status != 200 {
+		return "", fmt.Errorf("login: %d %s", status, firstLine(body))
+	}
+	return body, nil
+}
+
+// parseSocket returns a copy of base at the host:port address.
+func parseSocket(base Socket, addr string) (Socket, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return base, err
+	}
+	base.IP = host
+	if base.Port, err = strconv.Atoi(port); err != nil {
+		return base, fmt.Errorf("invalid port %s", port)
+	}
+	return base, nil
+}
+
+func maskPassword(password string) string {
+	if password == "" {
+		return ""
+	}
+	return "********"
+}
+
+func mustLoadConfig() {
+	if configErr != nil {
+		log.Errorf("%v", configErr)
+		os.Exit(exitUsage)
+	}
+}
+
+func mustGetEnv(name string) Server {
+	svr, found := svrMap[name]
+	if !found {
+		log.Errorf("env: %s not found in %s", name, configFile)
+		os.Exit(exitUsage)
+	}
+	return svr
+}
+
+func mustGetString(cmd *cobra.Command, flag string) string {
+	s, err := cmd.Flags().GetString(flag)
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
+	return s
+}
+
+func mustGetBool(cmd *cobra.Command, flag string) bool {
+	b, err := cmd.Flags().GetBool(flag)
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
+	return b
+}
+
+func init() {
+	envAddCmd.Flags().String("desc", "", "the description of the env")
+	envAddCmd.Flags().String("tcm", "", "the host:port of the tcm, which reloads the configurations")
+	envAddCmd.Flags().StringArray("node", nil, "the host:port of a node, repeat it for each node")
+	envAddCmd.Flags().String("username", "", "the username of the tcm and the nodes")
+	envAddCmd.Flags().String("scheme", "", `"http" or "https", http by default`)
+	envAddCmd.Flags().String("baseurl", "", "the base url of the tcm and the nodes")
+	envAddCmd.Flags().String("ca", "", "the PEM bundle of the CAs trusted for https")
+	envAddCmd.Flags().Bool("force", false, "replace the env if it exists")
+	envCmd.AddCommand(envListCmd, envShowCmd, envAddCmd, envRemoveCmd, envTestCmd)
+	rootCmd.AddCommand(envCmd)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSocket(t *testing.T) {
+	base := Socket{Username: "admin", Scheme: "https", BaseURL: "/files"}
+	so, err := parseSocket(base, "10.0.0.1:8443")
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:8443/files", so.GetUrl())
+	assert.Equal(t, "admin", so.Username)
+
+	_, err = parseSocket(base, "10.0.0.1")
+	assert.Error(t, err)
+	_, err = parseSocket(base, "10.0.0.1:http")
+	assert.Error(t, err)
+}
+
+func TestMaskPassword(t *testing.T) {
+	assert.Empty(t, maskPassword(""))
+	assert.Equal(t, "********", maskPassword("secret"))
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	saved := configFile
+	t.Cleanup(func() { configFile = saved })
+	configFile = filepath.Join(t.TempDir(), "config.json")
+
+	_, err := loadConfig()
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	envs := map[string]Server{
+		"dev": {
+			Desc:     "daily build",
+			Tcm:      Socket{IP: "10.0.0.1", Port: 8080},
+			Nodes:    []Socket{{IP: "10.0.0.2", Port: 8080}, {IP: "10.0.0.3", Port: 8080}},
+			Prefixes: []string{"/game"},
+		},
+	}
+	require.NoError(t, saveConfig(envs))
+	info, err := os.Stat(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := loadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, envs, loaded)
+
+	// an invalid env is reported with its name
+	envs["bad"] = Server{Tcm: Socket{Scheme: "ftp"}}
+	require.NoError(t, saveConfig(envs))
+	_, err = loadConfig()
+	assert.Contains(t, err.Error(), "env bad")
+}
+
+func TestDemoConfig(t *testing.T) {
+	saved := configFile
+	t.Cleanup(func() { configFile = saved })
+	configFile = "config_demo.json"
+
+	envs, err := loadConfig()
+	require.NoError(t, err)
+	env := envs["myenv"]
+	// the tcm and the node are the same server
+	assert.Equal(t, env.Tcm.GetUrl(), env.Nodes[0].GetUrl())
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// localFile is a file to upload and its path on the nodes.
+type localFile struct {
+	Path   string // local path
+	Remote string // path in the user scope of the nodes, e.g. /wedo/ServerConfig/a.xml
+	SHA256 string // only computed with --sync
+}
+
+// fileSHA256 returns the hex encoded sha256 of the file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// collectFiles returns the files matched by pattern, which is a file, a
+// directory or a glob. The files of directories and globs keep their path
+// relative to the directory, or to the directory of the glob, under dir.
+// A single file is uploaded where the mapping rules of svr point to.
+func collectFiles(svr *Server, pattern, dir string) ([]localFile, error) {
+	if !hasMeta(pattern) {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			remote, err := svr.remotePath(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if err := svr.checkPrefix(remote); err != nil {
+				return nil, err
+			}
+			return []localFile{{Path: pattern, Remote: remote}}, nil
+		}
+		return walkFiles(pattern, pattern, dir)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no file matches %s", pattern)
+	}
+
+	base := filepath.Dir(pattern)
+	for hasMeta(base) {
+		base = filepath.Dir(base)
+	}
+
+	var files []localFile
+	for _, match := range matches {
+		found, err := walkFiles(base, match, dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// walkFiles returns the files of the tree at root, which are uploaded
+// under dir with their path relative to base. Hidden files are skipped.
+func walkFiles(base, root, dir string) ([]localFile, error) {
+	var files []localFile
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && p != root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, localFile{
+			Path:   p,
+			Remote: path.Join(dir, filepath.ToSlash(rel)),
+		})
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Remote < files[j].Remote
+	})
+	return files, err
+}
+
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[`)
+}
@@ -1,177 +1,532 @@
 package main
 
 import (
-    "bytes"
-    "encoding/json"
-    "fmt"
-    "io"
-    "io/ioutil"
-    "mime/multipart"
-    "net/http"
-    "os"
-    "strconv"
-    "strings"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/filebrowser/filebrowser/v2/reload"
+	"github.com/filebrowser/filebrowser/v2/session"
 )
 
 type LoginFields struct {
-    Username  string `json:"username"`
-    Password  string `json:"password"`
-    Recaptcha string `json:"recaptcha"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Recaptcha string `json:"recaptcha"`
 }
 
+// maxRetryWait caps the exponential backoff between two attempts.
+const maxRetryWait = 30 * time.Second
+
+// errChunksUnsupported means the node has no resumable upload endpoint.
+var errChunksUnsupported = errors.New("resumable uploads are not supported")
+
 func UnescapeUnicode(raw []byte) ([]byte, error) {
-    str, err := strconv.Unquote(strings.ReplaceAll(strconv.Quote(string(raw)), `\\u`, `\u`))
-    if err != nil {
-        return nil, err
-    }
-    return []byte(str), nil
-}
-
-func (s *Socket) login() (int, string) {
-    b, err := json.Marshal(LoginFields{Username: s.Username, Password: s.Password, Recaptcha: ""})
-    if err != nil {
-        log.Errorf("json encode failed")
-        return http.StatusBadRequest, ""
-    }
-    url := s.GetUrl() 
-    url += "/api/login"
-    resp, err := http.Post(url, "application/json", bytes.NewBuffer(b))
-    if err != nil {
-        log.Errorf("http request post: %v", err)
-        return http.StatusNotFound, ""
-    }
-    defer resp.Body.Close()
-
-    respBody, err := ioutil.ReadAll(resp.Body)
-    if err != nil {
-        log.Errorf("read response body failed: %v", err)
-        return http.StatusNoContent, ""
-    }
-
-    respBody, _ = UnescapeUnicode(respBody)
-    return resp.StatusCode, string(respBody)
-}
-
-func (s *Socket) renew(jwt string) (int, string) {
-    url := s.GetUrl()
-    url += "/api/renew"
-    req, err := http.NewRequest("POST", url, &bytes.Buffer{})
-    if err != nil {
-        log.Errorf("http new request failed: %v", err)
-        return http.StatusNotFound, ""
-    }
-    req.Header.Set("X-Auth", jwt)
-    client := &http.Client{}
-    resp, err := client.Do(req)
-    if err != nil {
-        log.Errorf("http post request failed: %v", err)
-        return http.StatusNotFound, ""
-    }
-    defer resp.Body.Close()
-
-    respBody, err := ioutil.ReadAll(resp.Body)
-    if err != nil {
-        log.Errorf("read response body failed: %v", err)
-        return http.StatusNoContent, ""
-    }
-
-    respBody, _ = UnescapeUnicode(respBody)
-    return resp.StatusCode, string(respBody)
-}
-
-func (s *Socket) upload(path, dir, uuid, jwt string) (int, string) {
-    url := s.GetUrl()
-    url += "/api/resources/wedo/"
-    query := fmt.Sprintf("?override=%s&dir=%s&uuid=%s", "true", dir, uuid)
-    if strings.Contains(path, "ClientConfig") {
-        idx := strings.Index(path, "ClientConfig")
-        relative := path[idx:]
-        url += relative + query
-    } else if strings.Contains(path, "Common") {
-        idx := strings.Index(path, "DB")
-        relative := "ClientConfig/CSCommon/" + path[idx:]
-        url += relative + query
-    } else if strings.Contains(path, "ServerConfig") {
-        idx := strings.Index(path, "ServerConfig")
-        relative := path[idx:]
-        url += relative + query
-    }
-
-    bodyBuf := &bytes.Buffer{}
-    bodyWriter := multipart.NewWriter(bodyBuf)
-    fileWriter, err := bodyWriter.CreateFormFile("uploadfile", path)
-    if err != nil {
-        log.Errorf("write to buffer failed: %v", err)
-        return http.StatusBadRequest, ""
-    }
-
-    f, err := os.Open(path)
-    if err != nil {
-        log.Errorf("open file failed: %v", err)
-        return http.StatusBadRequest, ""
-    }
-    defer f.Close()
-
-    _, err = io.Copy(fileWriter, f)
-    if err != nil {
-        log.Errorf("copy file content to body buffer failed: %v", err)
-        return http.StatusBadRequest, ""
-    }
-
-    contentType := bodyWriter.FormDataContentType()
-    bodyWriter.Close()
-
-    req, err := http.NewRequest("POST", url, bodyBuf)
-    if err != nil {
-        log.Errorf("http new request failed: %v", err)
-        return http.StatusNotFound, ""
-    }
-    req.Header.Set("X-Auth", jwt)
-    req.Header.Set("Content-Type", contentType)
-
-    client := &http.Client{}
-    resp, err := client.Do(req)
-    if err != nil {
-        log.Errorf("http post request failed: %v", err)
-        return http.StatusNotFound, ""
-    }
-    defer resp.Body.Close()
-
-    respBody, err := ioutil.ReadAll(resp.Body)
-    if err != nil {
-        log.Errorf("read response body failed: %v", err)
-        return http.StatusNoContent, ""
-    }
-
-    respBody, _ = UnescapeUnicode(respBody)
-    return resp.StatusCode, string(respBody)
-}
-
-func (s *Socket) reload(uuid, jwt string) (int, string) {
-    url := s.GetUrl()
-    url += "/api/reload?uuid=" + uuid
-
-    reqest, err := http.NewRequest("GET", url, nil)
-    if err != nil {
-        log.Errorf("http new request failed: %v", err)
-        return http.StatusNotFound, ""
-    }
-    reqest.Header.Add("X-Auth", jwt)
-
-    client := &http.Client{}
-    resp, err := client.Do(reqest)
-    if err != nil {
-        log.Errorf("http post request failed: %v", err)
-        return http.StatusNotFound, ""
-    }
-    defer resp.Body.Close()
-
-    respBody, err := ioutil.ReadAll(resp.Body)
-    if err != nil {
-        log.Errorf("read response body failed: %v", err)
-        return http.StatusNoContent, ""
-    }
-
-    respBody, _ = UnescapeUnicode(respBody)
-    return resp.StatusCode, string(respBody)
+	str, err := strconv.Unquote(strings.ReplaceAll(strconv.Quote(string(raw)), `\\u`, `\u`))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(str), nil
+}
+
+// The requests return the status and body of the response, or an error if
+// there is no response. Transport errors and 5xx responses of idempotent
+// requests are retried with exponential backoff.
+
+func (s *Socket) login() (int, string, error) {
+	b, err := json.Marshal(LoginFields{Username: s.Username, Password: s.Password, Recaptcha: ""})
+	if err != nil {
+		return 0, "", err
+	}
+	return s.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", s.GetUrl()+"/api/login", bytes.NewReader(b))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, err
+	}, "", true)
+}
+
+func (s *Socket) renew(jwt string) (int, string, error) {
+	return s.do(func() (*http.Request, error) {
+		return http.NewRequest("POST", s.GetUrl()+"/api/renew", &bytes.Buffer{})
+	}, jwt, true)
+}
+
+// upload uploads the file in one request, or in chunks if it is larger
+// than the chunk size and the node supports it.
+func (s *Socket) upload(file localFile, dir, uuid, jwt string) (int, string, error) {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return 0, "", err
+	}
+	if chunkSize > 0 && info.Size() > chunkSize {
+		status, body, err := s.uploadChunks(file, info.Size(), dir, uuid, jwt)
+		if err != errChunksUnsupported {
+			return status, body, err
+		}
+		log.Warningf("%s: %v, uploading %s at once", s.GetUrl(), err, file.Path)
+	}
+
+	// the server stores the request body as is
+	return s.transfer(func() (*http.Request, error) {
+		f, err := os.Open(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest("POST", s.resourceURL(file, dir, uuid, nil), f)
+		if err != nil {
+			f.Close()
+		}
+		return req, err
+	}, jwt, true)
+}
+
+func (s *Socket) resourceURL(file localFile, dir, uuid string, query neturl.Values) string {
+	if query == nil {
+		query = neturl.Values{}
+	}
+	query.Set("override", "true")
+	query.Set("dir", dir)
+	query.Set("uuid", uuid)
+	remote := (&neturl.URL{Path: file.Remote}).EscapedPath()
+	return s.GetUrl() + "/api/resources" + remote + "?" + query.Encode()
+}
+
+// uploadChunks appends the file to its chunks on the node from where the
+// last attempt stopped, then completes the upload with them.
+func (s *Socket) uploadChunks(file localFile, size int64, dir, uuid, jwt string) (int, string, error) {
+	remote := (&neturl.URL{Path: file.Remote}).EscapedPath()
+	url := s.GetUrl() + "/api/chunks" + remote + "?uuid=" + neturl.QueryEscape(uuid)
+
+	offset, err := s.chunkOffset(url, jwt)
+	if err != nil {
+		return 0, "", err
+	}
+	if offset > 0 {
+		log.Infof("resume the upload of %s to %s at %d of %d bytes", file.Path, s.GetUrl(), offset, size)
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	failures := 0
+	wait := retryWait
+	for offset < size {
+		n := size - offset
+		if n > chunkSize {
+			n = chunkSize
+		}
+		req, err := http.NewRequest("PATCH", url+"&offset="+strconv.FormatInt(offset, 10),
+			io.NewSectionReader(f, offset, n))
+		if err != nil {
+			return 0, "", err
+		}
+		req.ContentLength = n
+		req.Header.Set("X-Auth", jwt)
+
+		resp, body, err := s.roundTrip(s.transferClient(), req)
+		if err == nil && resp.StatusCode < 500 {
+			// the chunks on the node may also be ahead of or behind offset
+			next, perr := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+			if perr != nil || (resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusConflict) {
+				return resp.StatusCode, body, nil
+			}
+			if next > offset {
+				failures = 0
+				wait = retryWait
+			}
+			offset = next
+			continue
+		}
+		if err == nil {
+			err = &statusError{Status: resp.StatusCode, Body: body}
+		}
+
+		failures++
+		if failures > retries {
+			return 0, "", err
+		}
+		log.Warningf("upload %s to %s at %d: %v, retry in %s", file.Path, s.GetUrl(), offset, err, wait)
+		time.Sleep(wait)
+		wait = nextWait(wait)
+		if offset, err = s.chunkOffset(url, jwt); err != nil {
+			return 0, "", err
+		}
+	}
+
+	if file.SHA256 == "" {
+		if file.SHA256, err = fileSHA256(file.Path); err != nil {
+			return 0, "", err
+		}
+	}
+	// a completion whose response is lost is retried, the node finds the
+	// chunks completed with the same sha256 and succeeds again
+	query := neturl.Values{}
+	query.Set("chunked", "true")
+	query.Set("sha256", file.SHA256)
+	return s.do(func() (*http.Request, error) {
+		return http.NewRequest("POST", s.resourceURL(file, dir, uuid, query), nil)
+	}, jwt, true)
+}
+
+// chunkOffset returns how many bytes of the file the node has received.
+func (s *Socket) chunkOffset(url, jwt string) (int64, error) {
+	var offset int64
+	status, body, err := s.doResponse(s.client(), func() (*http.Request, error) {
+		return http.NewRequest("HEAD", url, nil)
+	}, jwt, true, func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusNoContent {
+			return nil
+		}
+		var err error
+		offset, err = strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+		return err
+	})
+	switch {
+	case err != nil:
+		return 0, err
+	case status == http.StatusNoContent:
+		return offset, nil
+	case status == http.StatusOK || status == http.StatusNotFound || status == http.StatusMethodNotAllowed:
+		// old nodes have no such route, or serve the frontend instead
+		return 0, errChunksUnsupported
+	}
+	return 0, &statusError{Status: status, Body: body}
+}
+
+// checksum returns the sha256 of the remote file, the status is 404 if it
+// does not exist.
+func (s *Socket) checksum(remote, jwt string) (int, string, error) {
+	path := (&neturl.URL{Path: remote}).EscapedPath()
+	status, body, err := s.get("/api/resources"+path+"?checksum=sha256", jwt, true)
+	if err != nil || status != http.StatusOK {
+		return status, body, err
+	}
+
+	var info struct {
+		Checksums map[string]string `json:"checksums"`
+	}
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		return 0, "", fmt.Errorf("decode the checksum of %s: %v", remote, err)
+	}
+	return status, info.Checksums["sha256"], nil
+}
+
+// remoteFile is a file or directory on a node, as listed by /api/resources.
+type remoteFile struct {
+	Path  string        `json:"path"`
+	Name  string        `json:"name"`
+	Size  int64         `json:"size"`
+	IsDir bool          `json:"isDir"`
+	Items []*remoteFile `json:"items"`
+}
+
+// stat returns the file at path, with its items if it is a directory.
+func (s *Socket) stat(path, jwt string) (*remoteFile, error) {
+	escaped := (&neturl.URL{Path: path}).EscapedPath()
+	status, body, err := s.get("/api/resources"+escaped, jwt, true)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("stat %s: %d %s", path, status, firstLine(body))
+	}
+
+	f := &remoteFile{}
+	if err := json.Unmarshal([]byte(body), f); err != nil {
+		return nil, fmt.Errorf("decode %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// download writes the content of the file at path to dst, it is retried
+// like the other idempotent requests.
+func (s *Socket) download(path, jwt, dst string) error {
+	escaped := (&neturl.URL{Path: path}).EscapedPath()
+	url := s.GetUrl() + "/api/raw" + escaped
+
+	wait := retryWait
+	var err error
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			log.Warningf("download %s from %s: %v, retry in %s", path, s.GetUrl(), err, wait)
+			time.Sleep(wait)
+			wait = nextWait(wait)
+		}
+		var retry bool
+		if retry, err = s.downloadOnce(url, jwt, dst); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *Socket) downloadOnce(url, jwt, dst string) (bool, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Auth", jwt)
+
+	resp, err := s.transferClient().Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode >= 500, &statusError{Status: resp.StatusCode, Body: string(body)}
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return true, err
+	}
+	return false, f.Close()
+}
+
+// version returns the version of the node, "unknown" if it is too old to
+// tell it.
+func (s *Socket) version(jwt string) (string, error) {
+	status, body, err := s.get("/api/version", jwt, true)
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusNotFound {
+		return "unknown", nil
+	}
+	if status != http.StatusOK {
+		return "", &statusError{Status: status, Body: body}
+	}
+
+	var v struct {
+		Version   string `json:"version"`
+		CommitSHA string `json:"commitSHA"`
+	}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		// old nodes serve the frontend instead
+		return "unknown", nil
+	}
+	return v.Version + "/" + v.CommitSHA, nil
+}
+
+// reload and rollback are not retried, the node may have started them.
+
+// query holds the uuid of the session, and its canary if any.
+func (s *Socket) reload(query, jwt string) (int, string, error) {
+	return s.get("/api/reload?"+query, jwt, false)
+}
+
+// streamReload reloads through the reload stream WebSocket and calls onEvent
+// for each event as it arrives. It returns the status of the handshake and
+// the final "done" event, which is nil if the stream ended early.
+func (s *Socket) streamReload(query, jwt string, onEvent func(*reload.Event)) (int, *reload.Event, error) {
+	url := "ws" + strings.TrimPrefix(s.GetUrl(), "http") + "/api/reload/stream?" + query
+	header := http.Header{}
+	header.Set("X-Auth", jwt)
+
+	conn, resp, err := s.dialer().Dial(url, header)
+	if err != nil {
+		if resp != nil {
+			return resp.StatusCode, nil, nil
+		}
+		return 0, nil, err
+	}
+	defer conn.Close()
+
+	for {
+		e := &reload.Event{}
+		if err := conn.ReadJSON(e); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return http.StatusOK, nil, fmt.Errorf("read reload event: %v", err)
+			}
+			return http.StatusOK, nil, nil
+		}
+		onEvent(e)
+		if e.Type == reload.EventDone {
+			return http.StatusOK, e, nil
+		}
+	}
+}
+
+func (s *Socket) rollback(uuid, jwt string, reload bool) (int, string, error) {
+	return s.get(fmt.Sprintf("/api/reload/rollback?uuid=%s&reload=%t", uuid, reload), jwt, false)
+}
+
+func (s *Socket) plan(uuid, jwt string) (int, string, error) {
+	return s.get("/api/reload/plan?uuid="+uuid, jwt, true)
+}
+
+// sessionState returns the state of the session on the node, empty if it
+// is unknown.
+func (s *Socket) sessionState(uuid, jwt string) session.State {
+	status, body, err := s.get("/api/reload/sessions?uuid="+uuid, jwt, true)
+	if err != nil || status != http.StatusOK {
+		return ""
+	}
+	var sessions []*session.Session
+	if err := json.Unmarshal([]byte(body), &sessions); err != nil || len(sessions) != 1 {
+		return ""
+	}
+	return sessions[0].State
+}
+
+func (s *Socket) diff(uuid, jwt string) (int, string, error) {
+	return s.get("/api/reload/diff?uuid="+uuid, jwt, true)
+}
+
+// supportsCanary tells whether the node reloads the canary of a session,
+// the nodes which do not would ignore it and reload everything.
+func (s *Socket) supportsCanary(uuid, inst, jwt string) (bool, error) {
+	status, body, err := s.get("/api/reload/plan?"+neturl.Values{"uuid": {uuid}, "canary": {inst}}.Encode(), jwt, true)
+	if err != nil {
+		return false, err
+	}
+	if status == http.StatusNotFound || status == http.StatusMethodNotAllowed {
+		return false, nil
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("plan: %d %s", status, firstLine(body))
+	}
+
+	plan := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(body), &plan); err != nil {
+		return false, fmt.Errorf("decode plan: %v", err)
+	}
+	_, found := plan["canary"]
+	return found, nil
+}
+
+func (s *Socket) promoteCanary(uuid, jwt string) (int, string, error) {
+	return s.get("/api/reload/promote?uuid="+uuid, jwt, false)
+}
+
+func (s *Socket) abortCanary(uuid, jwt string) (int, string, error) {
+	return s.get("/api/reload/abort?uuid="+uuid, jwt, false)
+}
+
+func (s *Socket) get(path, jwt string, retry bool) (int, string, error) {
+	return s.do(func() (*http.Request, error) {
+		return http.NewRequest("GET", s.GetUrl()+path, nil)
+	}, jwt, retry)
+}
+
+// statusError is a response which is retried, it is returned once there
+// are no retries left.
+type statusError struct {
+	Status int
+	Body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, firstLine(e.Body))
+}
+
+// firstLine returns the first line of a response body for the messages.
+func firstLine(body string) string {
+	return strings.SplitN(strings.TrimSpace(body), "\n", 2)[0]
+}
+
+// do sends the request made by newReq, which is made again for each
+// attempt.
+func (s *Socket) do(newReq func() (*http.Request, error), jwt string, retry bool) (int, string, error) {
+	return s.doResponse(s.client(), newReq, jwt, retry, nil)
+}
+
+// transfer is do for the requests which send a file, they are sent with
+// the transfer client.
+func (s *Socket) transfer(newReq func() (*http.Request, error), jwt string, retry bool) (int, string, error) {
+	return s.doResponse(s.transferClient(), newReq, jwt, retry, nil)
+}
+
+// doResponse is do with the client c, which also hands the response to
+// check, its error is returned with the status.
+func (s *Socket) doResponse(c *http.Client, newReq func() (*http.Request, error), jwt string, retry bool,
+	check func(*http.Response) error) (int, string, error) {
+	attempts := 1
+	if retry {
+		attempts += retries
+	}
+
+	wait := retryWait
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			log.Warningf("request %s: %v, retry in %s", s.GetUrl(), err, wait)
+			time.Sleep(wait)
+			wait = nextWait(wait)
+		}
+
+		var req *http.Request
+		if req, err = newReq(); err != nil {
+			return 0, "", err
+		}
+		if jwt != "" {
+			req.Header.Set("X-Auth", jwt)
+		}
+
+		var resp *http.Response
+		var body string
+		resp, body, err = s.roundTrip(c, req)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			err = &statusError{Status: resp.StatusCode, Body: body}
+			continue
+		}
+		if check != nil {
+			return resp.StatusCode, body, check(resp)
+		}
+		return resp.StatusCode, body, nil
+	}
+
+	if serr, ok := err.(*statusError); ok {
+		return serr.Status, serr.Body, nil
+	}
+	return 0, "", err
+}
+
+// roundTrip sends the request once with the client c and reads the whole
+// response.
+func (s *Socket) roundTrip(c *http.Client, req *http.Request) (*http.Response, string, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("read response body: %v", err)
+	}
+
+	respBody, _ = UnescapeUnicode(respBody)
+	return resp, string(respBody), nil
+}
+
+func nextWait(wait time.Duration) time.Duration {
+	if wait *= 2; wait > maxRetryWait {
+		return maxRetryWait
+	}
+	return wait
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dropConn closes the connection of the request without a response.
+func dropConn(t *testing.T, w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestDoRetries(t *testing.T) {
+	setFlags(t)
+	node := newFakeNode(t)
+	var calls int
+	node.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			dropConn(t, w)
+		case 2:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("v2"))
+		}
+	})
+
+	// without retries the first failure is returned
+	_, _, err := node.Socket.get("/api/version", "", true)
+	assert.Error(t, err)
+	status, _, err := node.Socket.get("/api/version", "", true)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	calls = 0
+	retries = 2
+	status, body, err := node.Socket.get("/api/version", "", true)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "v2", body)
+	assert.Equal(t, 3, calls)
+
+	// the requests which are not idempotent are sent once
+	calls = 1
+	status, _, err = node.Socket.get("/api/version", "", false)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestNextWait(t *testing.T) {
+	assert.Equal(t, 2*time.Second, nextWait(time.Second))
+	assert.Equal(t, maxRetryWait, nextWait(20*time.Second))
+	assert.Equal(t, maxRetryWait, nextWait(maxRetryWait))
+}
+
+// chunkNode receives resumable uploads like the server does.
+type chunkNode struct {
+	*fakeNode
+	mu       sync.Mutex
+	chunks   []byte
+	files    map[string][]byte
+	patches  int
+	finishes int
+}
+
+func newChunkNode(t *testing.T) *chunkNode {
+	n := &chunkNode{fakeNode: newFakeNode(t), files: map[string][]byte{}}
+	n.HandleFunc("/api/chunks/", func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if r.Method == http.MethodPatch {
+			n.patches++
+			if offset, _ := strconv.Atoi(r.URL.Query().Get("offset")); offset != len(n.chunks) {
+				w.Header().Set("Upload-Offset", strconv.Itoa(len(n.chunks)))
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			// the second chunk is cut off half way
+			if n.patches == 2 {
+				half := make([]byte, r.ContentLength/2)
+				_, err := io.ReadFull(r.Body, half)
+				require.NoError(t, err)
+				n.chunks = append(n.chunks, half...)
+				dropConn(t, w)
+				return
+			}
+			b, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			n.chunks = append(n.chunks, b...)
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(n.chunks)))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	n.HandleFunc("/api/resources/", func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if r.URL.Query().Get("chunked") != "true" {
+			b, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			n.files[r.URL.Path] = b
+			return
+		}
+		n.finishes++
+		if n.chunks != nil {
+			n.files[r.URL.Path], n.chunks = n.chunks, nil
+		} else if r.URL.Query().Get("sha256") != sha256Of(n.files[r.URL.Path]) {
+			http.NotFound(w, r)
+			return
+		}
+		// the response of the first completion is lost
+		if n.finishes == 1 {
+			dropConn(t, w)
+		}
+	})
+	return n
+}
+
+func sha256Of(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadChunks(t *testing.T) {
+	setFlags(t)
+	retries, chunkSize = 3, 4
+	node := newChunkNode(t)
+
+	content := []byte("0123456789abcdefghij")
+	path := filepath.Join(t.TempDir(), "item.db")
+	require.NoError(t, ioutil.WriteFile(path, content, 0644))
+	file := localFile{Path: path, Remote: "/ClientConfig/item.db"}
+
+	status, _, err := node.Socket.upload(file, "/ClientConfig", "uuid", "jwt")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, content, node.files["/api/resources/ClientConfig/item.db"])
+	// the cut off chunk is resumed from where it stopped, the completion is
+	// sent again once its response is lost
+	assert.Equal(t, 6, node.patches)
+	assert.Equal(t, 2, node.finishes)
+
+	// small files are uploaded at once
+	small := filepath.Join(t.TempDir(), "a.xml")
+	require.NoError(t, ioutil.WriteFile(small, []byte("abc"), 0644))
+	status, _, err = node.Socket.upload(localFile{Path: small, Remote: "/ClientConfig/a.xml"}, "/ClientConfig", "uuid", "jwt")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []byte("abc"), node.files["/api/resources/ClientConfig/a.xml"])
+}
+
+func TestTransferIdleTimeout(t *testing.T) {
+	setFlags(t)
+	timeout = 200 * time.Millisecond
+	node := newFakeNode(t)
+	// the file takes longer than the timeout, but it keeps coming
+	node.HandleFunc("/api/raw/slow", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 6; i++ {
+			w.Write(bytes.Repeat([]byte{'x'}, 10))
+			w.(http.Flusher).Flush()
+			time.Sleep(timeout / 2)
+		}
+	})
+	node.HandleFunc("/api/raw/stalled", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("x"))
+		w.(http.Flusher).Flush()
+		time.Sleep(3 * timeout)
+	})
+
+	dst := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, node.Socket.download("/slow", "jwt", dst))
+	b, err := ioutil.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Len(t, b, 60)
+
+	err = node.Socket.download("/stalled", "jwt", dst)
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+    "crypto/tls"
     "encoding/json"
     "fmt"
     "io/ioutil"
@@ -9,12 +10,24 @@ import (
 type Socket struct {
     IP       string `json:"ip"`
     Port     int    `json:"port"`
-    Username string `json:"username`
-    Password string `json:"password"`
+    Username string `json:"username"`
+    Password string `json:"password,omitempty"`
+    Scheme   string `json:"scheme,omitempty"`  // http or https, http by default
+    BaseURL  string `json:"baseURL,omitempty"` // the --baseurl of the server
+    CA       string `json:"ca,omitempty"`      // PEM bundle of the CAs trusted for https, the system ones by default
+    Cert     string `json:"cert,omitempty"`    // PEM client certificate
+    Key      string `json:"key,omitempty"`     // PEM key of the client certificate
+    Timeout  int    `json:"timeout,omitempty"` // request timeout in seconds, --timeout by default
+
+    tls *tls.Config
 }
 
 func (s *Socket) GetUrl() string {
-    return fmt.Sprintf("http://%s:%d", s.IP, s.Port)
+    scheme := s.Scheme
+    if scheme == "" {
+        scheme = "http"
+    }
+    return fmt.Sprintf("%s://%s:%d%s", scheme, s.IP, s.Port, s.BaseURL)
 }
 
 func (s *Socket) String() string {
@@ -22,27 +35,43 @@ func (s *Socket) String() string {
 }
 
 type Server struct {
-    Desc  string   `json:"desc"`
-    Tcm   Socket   `json:"tcm"`
-    Nodes []Socket `json:"nodes"`
+    Desc     string    `json:"desc"`
+    Tcm      Socket    `json:"tcm"`
+    Nodes    []Socket  `json:"nodes"`
+    Mappings []Mapping `json:"mappings,omitempty"` // local to remote path rules of single files
+    Prefixes []string  `json:"prefixes,omitempty"` // remote directories files can be uploaded to
 }
 
 func (s *Server) String() string {
     return fmt.Sprintf("desc: %s|tcm: %v|nodes: %v", s.Desc, s.Tcm, s.Nodes)
 }
 
+// configFile is the path of the config file, set by --config.
 var configFile = "config.json"
 
 func loadConfig() (map[string]Server, error) {
     var svrMap map[string]Server
     buffer, err := ioutil.ReadFile(configFile)
     if err != nil {
-        log.Errorf("read config file %s failed for %v", configFile, err)
-        return svrMap, err
+        return svrMap, fmt.Errorf("read config file %s failed: %w", configFile, err)
     }
     if err := json.Unmarshal(buffer, &svrMap); err != nil {
-        log.Errorf("JSON unmarshal failed for %v", err)
-        return svrMap, err
+        return svrMap, fmt.Errorf("JSON unmarshal of config file %s failed: %v", configFile, err)
+    }
+    for name, svr := range svrMap {
+        if err := svr.validate(); err != nil {
+            return svrMap, fmt.Errorf("env %s of config file %s is invalid: %v", name, configFile, err)
+        }
+        svrMap[name] = svr
     }
     return svrMap, nil
 }
+
+// saveConfig writes the envs to the config file, which may hold passwords.
+func saveConfig(svrMap map[string]Server) error {
+    buffer, err := json.MarshalIndent(svrMap, "", "    ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(configFile, append(buffer, '\n'), 0600)
+}
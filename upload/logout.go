@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "forget the cached tokens",
+	Long: `forget the tokens cached for the nodes of the env, or of all the envs if
+"env" is not set. The sessions are kept, so they can still be rolled back.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		env, _ := cmd.Flags().GetString("env")
+		s := openStore()
+		n := s.Logout(env)
+		if err := s.Save(); err != nil {
+			log.Errorf("save store failed: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d tokens removed\n", n)
+
+		if err := os.Remove(legacyStore); err == nil {
+			fmt.Printf("%s removed\n", legacyStore)
+		} else if !os.IsNotExist(err) {
+			log.Errorf("remove %s failed: %v", legacyStore, err)
+		}
+
+		if purge, _ := cmd.Flags().GetBool("keystore"); purge {
+			dir, err := configDir()
+			if err != nil {
+				log.Errorf("%v", err)
+				os.Exit(1)
+			}
+			if err := os.Remove(filepath.Join(dir, keystoreName)); err != nil && !os.IsNotExist(err) {
+				log.Errorf("remove keystore failed: %v", err)
+				os.Exit(1)
+			}
+			fmt.Println("keystore removed")
+		}
+	},
+}
+
+func init() {
+	logoutCmd.Flags().StringP("env", "e", "", "the name of the env to log out of, all the envs if empty")
+	logoutCmd.Flags().Bool("keystore", false, "also remove the saved credentials")
+	rootCmd.AddCommand(logoutCmd)
+}
@@ -1,25 +1,50 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
 	"os"
-	"strings"
+	"strconv"
+	"sync/atomic"
+	"time"
 
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/op/go-logging"
 	"github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"github.com/spf13/pflag"
+
+	"github.com/filebrowser/filebrowser/v2/reload"
+	"github.com/filebrowser/filebrowser/v2/session"
 )
 
 var (
-	cfgFile  string
-	env      string
-	file     string
-	dir      string
-	isReload bool
-	tmp      string = ".tmp.gob"
-	svrMap   map[string]Server
+	env             string
+	file            string
+	dir             string
+	isReload        bool
+	rollback        bool
+	dryRun          bool
+	showDiff        bool
+	workers         int
+	syncOnly        bool
+	printTarget     bool
+	timeout         time.Duration
+	retries         int
+	retryWait       time.Duration
+	chunkSize       int64
+	saveCredentials bool
+	policy          string
+	output          string
+	canary          string
+	canaryWatch     time.Duration
+	canaryPromote   bool
+	canaryAbort     bool
+	svrMap          map[string]Server
 )
 
 var log = logging.MustGetLogger("example")
@@ -28,8 +53,8 @@ var format = logging.MustStringFormatter(
 	`%{color}%{time:15:04:05.000}|%{longfile}|%{level:.6s}|%{color:reset}%{message}`,
 )
 
-func initLogger() {
-	backend := logging.NewLogBackend(os.Stdout, "", 0)
+func initLogger(w io.Writer) {
+	backend := logging.NewLogBackend(w, "", 0)
 
 	backendFormatter := logging.NewBackendFormatter(backend, format)
 
@@ -41,27 +66,32 @@ func initLogger() {
 
 // login to target node or tcm
 func isLoginCompleted(env string, st *Store, so *Socket) bool {
-	var jwt string
+	err := login(env, st, so)
+	report.addLogin(so, err)
+	if err != nil {
+		log.Errorf("login %s failed: %v", so.GetUrl(), err)
+		return false
+	}
+	return true
+}
+
+func login(env string, st *Store, so *Socket) error {
+	var err error
 	var uid string
-	if jwt = st.GetJwt(env, so.GetUrl()); jwt == "" { // jwt is null, need login
-		status, body := so.login()
-		if status != 200 {
-			log.Errorf("login %s failed for %s", so.GetUrl(), body)
-			return false
+	jwt := st.GetJwt(env, so.GetUrl())
+	if jwt == "" { // jwt is null, need login
+		if jwt, err = relogin(env, st, so); err != nil {
+			return err
 		}
-		jwt = body
-		st.SetJwt(env, so.GetUrl(), jwt)
 	}
 	// check whether jwt is still valid
-	if status, _ := so.renew(jwt); status != 200 {
-		if status == 403 { // jwt expired, need relogin
-			status, body := so.login()
-			if status != 200 {
-				log.Errorf("login %s failed for %s", so.GetUrl(), body)
-				return false
-			}
-			jwt = body
-			st.SetJwt(env, so.GetUrl(), jwt)
+	status, _, err := so.renew(jwt)
+	if err != nil {
+		return fmt.Errorf("renew: %v", err)
+	}
+	if status == 403 { // jwt expired, need relogin
+		if _, err := relogin(env, st, so); err != nil {
+			return err
 		}
 	}
 	// log.Debugf("jwt: %s", jwt)
@@ -71,38 +101,352 @@ func isLoginCompleted(env string, st *Store, so *Socket) bool {
 		st.SetUuid(env, so.GetUrl(), uid)
 	}
 	// log.Debugf("uuid: %s", uid)
-	return true
+	return nil
+}
+
+func relogin(env string, st *Store, so *Socket) (string, error) {
+	if err := resolveCredentials(env, so); err != nil {
+		return "", err
+	}
+	status, body, err := so.login()
+	if err != nil {
+		return "", err
+	}
+	if status != 200 {
+		return "", fmt.Errorf("%d %s", status, firstLine(body))
+	}
+	st.SetJwt(env, so.GetUrl(), body)
+	return body, nil
 }
 
-// this function can only be called after successful login
-func isUploadCompleted(env string, st *Store, so *Socket, file string, dir string) bool {
+// upload the files to the node, this function can only be called after successful login
+func uploadNode(env string, st *Store, so *Socket, files []localFile, dir string, res *nodeResult) error {
 	jwt := st.GetJwt(env, so.GetUrl())
 	uid := st.GetUuid(env, so.GetUrl())
-	status, body := so.upload(file, dir, uid, jwt)
-	if status != 200 {
-		log.Errorf("upload file %s failed for %s", file, body)
-		return false
+	for _, file := range files {
+		change := ""
+		if syncOnly {
+			status, sum, err := so.checksum(file.Remote, jwt)
+			switch {
+			case err != nil:
+				return fmt.Errorf("checksum %s: %v", file.Remote, err)
+			case status == http.StatusOK && sum == file.SHA256:
+				res.Unchanged++
+				continue
+			case status == http.StatusOK:
+				change = "M " + file.Remote
+			case status == http.StatusNotFound:
+				change = "A " + file.Remote
+			default:
+				return fmt.Errorf("checksum %s: %d", file.Remote, status)
+			}
+		}
+
+		status, body, err := so.upload(file, dir, uid, jwt)
+		if err != nil {
+			log.Errorf("upload file %s to %s failed: %v", file.Path, so.GetUrl(), err)
+			return fmt.Errorf("upload %s: %v", file.Path, err)
+		}
+		if status != 200 {
+			log.Errorf("upload file %s to %s failed for %s", file.Path, so.GetUrl(), body)
+			return fmt.Errorf("upload %s: %d %s", file.Path, status, firstLine(body))
+		}
+		log.Infof("upload file %s to %s%s succeed", file.Path, so.GetUrl(), file.Remote)
+		res.Files++
+		if change != "" {
+			res.Changes = append(res.Changes, change)
+		}
+		if info, err := os.Stat(file.Path); err == nil {
+			res.Bytes += info.Size()
+		}
 	}
-	log.Infof("upload file %s succeed", file)
-	return true
+	return nil
+}
+
+var errLoginFailed = errors.New("login failed")
+
+// upload the files to all nodes concurrently, with all-or-nothing the nodes
+// are rolled back as soon as one of them fails
+func isUploadCompleted(env string, st *Store, nodes []Socket, files []localFile, dir string) (bool, []*nodeResult) {
+	var failed int32
+	stop := func() bool {
+		return policy == policyAllOrNothing && atomic.LoadInt32(&failed) > 0
+	}
+	results := runNodes(nodes, workers, stop, func(so *Socket, res *nodeResult) error {
+		var err error
+		if !isLoginCompleted(env, st, so) {
+			err = errLoginFailed
+		} else {
+			err = uploadNode(env, st, so, files, dir, res)
+		}
+		if err != nil {
+			atomic.AddInt32(&failed, 1)
+		}
+		return err
+	})
+
+	if failed > 0 && policy == policyAllOrNothing {
+		rollbackNodes(env, st, results)
+	}
+
+	report.Upload = results
+	if syncOnly && isText() {
+		printDiff(results)
+	}
+	if isText() {
+		printSummary(results)
+	}
+	if failed > 0 {
+		log.Errorf("upload failed on %d of %d nodes", countStatus(results, nodeFailed), len(nodes))
+	}
+	return failed == 0, results
+}
+
+// rollbackNodes rolls back the sessions of the uploaded nodes, and of the
+// failed ones which may have stored some of the files before failing. Only
+// the nodes which could not log in have nothing to roll back.
+func rollbackNodes(env string, st *Store, results []*nodeResult) {
+	for _, res := range results {
+		switch {
+		case res.Status == nodeOK:
+			if isRollbackCompleted(env, st, res.Node, false) {
+				res.Status = nodeRolledBack
+			}
+		case res.Status == nodeFailed && res.Err != errLoginFailed.Error():
+			// the node stays failed, the error tells it was rolled back
+			if isRollbackCompleted(env, st, res.Node, false) {
+				res.Err += ", rolled back"
+			}
+		}
+	}
+}
+
+// collectTargets returns the files to upload to the nodes of the env and
+// where they are uploaded.
+func collectTargets(svr *Server) ([]localFile, error) {
+	if err := svr.checkPrefix(dir); err != nil {
+		return nil, fmt.Errorf("dir: %v", err)
+	}
+	return collectFiles(svr, file, dir)
 }
 
 // this function can only be called by tcm after the file is uploaded successfully
 func isReloadCompleted(env string, st *Store, tcm *Socket) bool {
-    bRet := false
-    jwt := st.GetJwt(env, tcm.GetUrl())
+	jwt := st.GetJwt(env, tcm.GetUrl())
 	uid := st.GetUuid(env, tcm.GetUrl())
-	status, body := tcm.reload(uid, jwt)
+	report.Reload = &reloadResult{Node: tcm.GetUrl(), Lines: []string{}}
+	if canary != "" {
+		ok, err := tcm.supportsCanary(uid, canary, jwt)
+		if err == nil && !ok {
+			err = errors.New("the node does not support canary reloads")
+		}
+		if err != nil {
+			report.Reload.Error = err.Error()
+			log.Errorf("canary reload %s failed: %v", tcm.GetUrl(), err)
+			return false
+		}
+	}
+	bRet := isStreamReloadCompleted(tcm, reloadQuery(uid), jwt, report.Reload)
+	// the session refused before its reload, e.g. waiting for approval, goes on
+	if !bRet {
+		switch state := tcm.sessionState(uid, jwt); state {
+		case session.StateOpen, session.StatePending, session.StateApproved, session.StateRejected:
+			log.Errorf("session %s is still %s, it can be reloaded again", uid, state)
+			return false
+		}
+	}
+	st.SetLastUuid(env, tcm.GetUrl(), uid) // keep it for rollback
+	st.SetUuid(env, tcm.GetUrl(), "")      // reload is complete, reset uuid
+	return bRet
+}
+
+// reloadQuery returns the query of the reload of the session uid, with its
+// canary if any.
+func reloadQuery(uid string) string {
+	q := neturl.Values{"uuid": {uid}}
+	if canary != "" {
+		q.Set("canary", canary)
+		q.Set("watch", strconv.Itoa(int(canaryWatch/time.Second)))
+	}
+	return q.Encode()
+}
+
+// render the reload live, servers without the reload stream reload at once
+func isStreamReloadCompleted(tcm *Socket, query, jwt string, rr *reloadResult) bool {
+	var succeed, failed int
+	status, done, err := tcm.streamReload(query, jwt, func(e *reload.Event) {
+		switch e.Type {
+		case reload.EventLine:
+			rr.Lines = append(rr.Lines, e.Line)
+			if isText() {
+				fmt.Println(e.Line)
+			}
+		case reload.EventResult:
+			rr.Results = append(rr.Results, e.Result)
+			if e.Result.Status == reload.StatusFailed {
+				failed++
+			} else {
+				succeed++
+			}
+		}
+	})
+	rr.HTTPStatus = status
+	if err != nil {
+		rr.Error = err.Error()
+		log.Errorf("reload %s failed: %v", tcm.GetUrl(), err)
+		return false
+	}
+	if status == http.StatusNotFound || status == http.StatusMethodNotAllowed {
+		return isPlainReloadCompleted(tcm, query, jwt, rr)
+	}
+	if status != http.StatusOK {
+		rr.Error = fmt.Sprintf("reload status: %d", status)
+		log.Errorf("reload status: %d", status)
+		return false
+	}
+	if done == nil {
+		rr.Error = "the reload stream ended before the reload"
+		log.Errorf("reload stream of %s ended before the reload", tcm.GetUrl())
+		return false
+	}
+
+	rr.Status = done.Status
+	rr.Error = done.Error
+	if isText() {
+		fmt.Printf("reload %s: %d succeed, %d failed\n", done.Status, succeed, failed)
+	}
+	if done.Error != "" {
+		log.Errorf("reload result: %s", done.Error)
+	}
+	return done.Error == ""
+}
+
+func isPlainReloadCompleted(tcm *Socket, query, jwt string, rr *reloadResult) bool {
+	status, body, err := tcm.reload(query, jwt)
+	rr.HTTPStatus = status
+	if err != nil {
+		rr.Error = err.Error()
+		log.Errorf("reload %s failed: %v", tcm.GetUrl(), err)
+		return false
+	}
+	rr.parseBody(body)
 	if status != 200 {
+		rr.Error = fmt.Sprintf("reload status: %d", status)
 		log.Errorf("reload status: %d", status)
 		log.Errorf("reload result: %s", body)
+		return false
+	}
+	log.Infof("reload status: %d", status)
+	log.Infof("reload result: %s", body)
+	return true
+}
+
+// print what a reload of the session would do, without reloading
+func isPlanCompleted(env string, st *Store, tcm *Socket) bool {
+	jwt := st.GetJwt(env, tcm.GetUrl())
+	uid := st.GetUuid(env, tcm.GetUrl())
+	status, body, err := tcm.plan(uid, jwt)
+	if err != nil {
+		log.Errorf("plan %s failed: %v", tcm.GetUrl(), err)
+		return false
+	}
+	if status != 200 {
+		log.Errorf("plan status: %d", status)
+		log.Errorf("plan result: %s", body)
+		return false
+	}
+	if !isText() {
+		if json.Valid([]byte(body)) {
+			report.Plan = json.RawMessage(body)
+		}
+		return true
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(body), "", "    "); err != nil {
+		fmt.Println(body)
+		return true
+	}
+	fmt.Println(out.String())
+	return true
+}
+
+// roll back the current session of the node, or the last reloaded one
+func isRollbackCompleted(env string, st *Store, so *Socket, reload bool) bool {
+	rr := &reloadResult{Node: so.GetUrl(), Lines: []string{}}
+	report.addRollback(rr)
+	jwt := st.GetJwt(env, so.GetUrl())
+	uid := st.GetUuid(env, so.GetUrl())
+	if uid == "" {
+		uid = st.GetLastUuid(env, so.GetUrl())
+	}
+	if uid == "" {
+		rr.Error = "no session to roll back"
+		log.Errorf("no session to roll back on %s", so.GetUrl())
+		return false
+	}
+	status, body, err := so.rollback(uid, jwt, reload)
+	rr.HTTPStatus = status
+	if err != nil {
+		rr.Error = err.Error()
+		log.Errorf("rollback %s failed: %v", so.GetUrl(), err)
+		return false
+	}
+	rr.parseBody(body)
+	if status != 200 {
+		rr.Error = fmt.Sprintf("rollback status: %d", status)
+		log.Errorf("rollback status: %d", status)
+		log.Errorf("rollback result: %s", body)
+		return false
+	}
+	log.Infof("rollback status: %d", status)
+	log.Infof("rollback result: %s", body)
+	st.SetLastUuid(env, so.GetUrl(), "")
+	st.SetUuid(env, so.GetUrl(), "") // session is over, reset uuid
+	return true
+}
+
+// promote or abort the canary of the last reloaded session, the results are
+// printed as the reload ones.
+func isCanaryCompleted(env string, st *Store, tcm *Socket, promote bool) bool {
+	rr := &reloadResult{Node: tcm.GetUrl(), Lines: []string{}}
+	action, call := "abort", tcm.abortCanary
+	if promote {
+		action, call = "promote", tcm.promoteCanary
+		report.Reload = rr
 	} else {
-		log.Infof("reload status: %d", status)
-        log.Infof("reload result: %s", body)
-        bRet = true
+		report.addRollback(rr)
+	}
+
+	jwt := st.GetJwt(env, tcm.GetUrl())
+	uid := st.GetLastUuid(env, tcm.GetUrl())
+	if uid == "" {
+		rr.Error = "no canary to " + action
+		log.Errorf("no canary to %s on %s", action, tcm.GetUrl())
+		return false
 	}
-    st.SetUuid(env, tcm.GetUrl(), "") // reload is complete, reset uuid
-    return bRet
+	status, body, err := call(uid, jwt)
+	rr.HTTPStatus = status
+	if err != nil {
+		rr.Error = err.Error()
+		log.Errorf("%s canary %s failed: %v", action, tcm.GetUrl(), err)
+		return false
+	}
+	rr.parseBody(body)
+	if isText() {
+		for _, line := range rr.Lines {
+			fmt.Println(line)
+		}
+	}
+	if status != 200 {
+		rr.Error = fmt.Sprintf("%s canary status: %d", action, status)
+		log.Errorf("%s canary status: %d", action, status)
+		return false
+	}
+	// the aborted session is over
+	if !promote {
+		st.SetLastUuid(env, tcm.GetUrl(), "")
+	}
+	return true
 }
 
 var rootCmd = &cobra.Command{
@@ -112,63 +456,199 @@ var rootCmd = &cobra.Command{
 you want to change. Other options will remain unchanged. `,
 	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		if !isReload {
-			if file == "" || dir == "" {
-				cmd.Help()
-				os.Exit(1)
-			}
+		finish(run(cmd))
+	},
+}
+
+// run runs the upload command and returns its exit code.
+func run(cmd *cobra.Command) int {
+	if output != outputText && output != outputJSON {
+		log.Errorf("unknown output: %s", output)
+		cmd.Help()
+		return exitUsage
+	}
+	// stdout is only for the report
+	if !isText() {
+		initLogger(os.Stderr)
+	}
+	report.Env = env
+	if configErr != nil {
+		return fail(exitUsage, configErr)
+	}
+
+	if canary != "" && !isReload {
+		return fail(exitUsage, errors.New("canary: only used with reload"))
+	}
+	if canaryPromote && canaryAbort {
+		return fail(exitUsage, errors.New("canary: promote or abort, not both"))
+	}
+	if !isReload && !rollback && !dryRun && !showDiff && !canaryPromote && !canaryAbort {
+		if file == "" || dir == "" {
+			cmd.Help()
+			return exitUsage
 		}
-		svr, found := svrMap[env]
-		if !found {
-			log.Errorf("env: %s not found", env)
+	}
+	svr, found := svrMap[env]
+	if !found {
+		return fail(exitUsage, fmt.Errorf("env: %s not found", env))
+	}
+	tcm := svr.Tcm
+	nodes := svr.Nodes
+
+	// print where the files would be uploaded, without connecting
+	if printTarget {
+		if file == "" || dir == "" {
 			cmd.Help()
-			os.Exit(1)
+			return exitUsage
+		}
+		files, err := collectTargets(&svr)
+		if err != nil {
+			return fail(exitUsage, err)
+		}
+		for _, f := range files {
+			fmt.Printf("%s -> %s\n", f.Path, f.Remote)
 		}
-		tcm := svr.Tcm
-		nodes := svr.Nodes
+		return exitOK
+	}
+
+	s := openStore()
+	defer s.Save()
 
-		s := NewStore(tmp)
-		defer s.Save()
+	if policy != policyBestEffort && policy != policyAllOrNothing {
+		log.Errorf("unknown policy: %s", policy)
+		cmd.Help()
+		return exitUsage
+	}
+
+	// login tcm, the nodes login before uploading
+	if ok := isLoginCompleted(env, s, &tcm); !ok {
+		return fail(exitLogin, fmt.Errorf("login tcm %v failed", tcm))
+	}
 
-		// login tcm and all nodes
-		if ok := isLoginCompleted(env, s, &tcm); !ok {
-            log.Errorf("login tcm %v failed", tcm)
-            os.Exit(1)
+	// the canary of the last session reloads the other instances or is rolled back
+	if canaryPromote || canaryAbort {
+		if ok := isCanaryCompleted(env, s, &tcm, canaryPromote); !ok {
+			if canaryPromote {
+				report.Error = "canary promotion failed"
+				return exitReload
+			}
+			report.Error = "canary abort failed"
+			return exitRollback
 		}
+		return exitOK
+	}
+
+	// restore the files of the session on all nodes, only tcm can reload config
+	if rollback {
 		for _, node := range nodes {
 			if ok := isLoginCompleted(env, s, &node); !ok {
-                log.Errorf("login node %v failed", node)
-                os.Exit(1)
+				return fail(exitLogin, fmt.Errorf("login node %v failed", node))
 			}
 		}
 
-		// upload file to all nodes
-		if file != "" && dir != "" {
-			if !(strings.Contains(file, "ClientConfig") || strings.Contains(file, "Common") || strings.Contains(file, "ServerConfig")) {
-                log.Errorf("only files in the ClientConfig or ServerConfig directory can be uploaded")
-                os.Exit(1)
+		ok := true
+		tcmIsNode := false
+		for _, node := range nodes {
+			reload := isReload && node.GetUrl() == tcm.GetUrl()
+			tcmIsNode = tcmIsNode || reload
+			if !isRollbackCompleted(env, s, &node, reload) {
+				log.Errorf("rollback node %v failed", node)
+				ok = false
 			}
-
-			if !(strings.HasPrefix(dir, "/wedo/ClientConfig") || strings.HasPrefix(dir, "/wedo/ServerConfig")) {
-                log.Errorf("the relative path can only start with /wedo/ClientConfig or /wedo/ServerConfig")
-                os.Exit(1)
+		}
+		if isReload && !tcmIsNode {
+			if !isRollbackCompleted(env, s, &tcm, true) {
+				log.Errorf("rollback tcm %v failed", tcm)
+				ok = false
 			}
+		}
+		if !ok {
+			report.Error = "rollback failed"
+			return exitRollback
+		}
+		return exitOK
+	}
+
+	// upload file to all nodes
+	uploaded := true
+	var results []*nodeResult
+	if file != "" && dir != "" {
+		files, err := collectTargets(&svr)
+		if err != nil {
+			return fail(exitUsage, err)
+		}
 
-			for _, node := range nodes {
-				if ok := isUploadCompleted(env, s, &node, file, dir); !ok {
-                    log.Errorf("upload file %s to node %v failed", file, node)
-                    os.Exit(1)
+		if syncOnly {
+			for i := range files {
+				if files[i].SHA256, err = fileSHA256(files[i].Path); err != nil {
+					return fail(exitUsage, err)
 				}
 			}
 		}
 
-		// only tcm can reload config
-		if isReload {
-            if ok := isReloadCompleted(env, s, &tcm); !ok {
-                os.Exit(1)
-            }
+		// all the files are uploaded in the session, so one reload covers them
+		uploaded, results = isUploadCompleted(env, s, nodes, files, dir)
+		if !uploaded {
+			report.Error = fmt.Sprintf("upload failed on %d of %d nodes", countStatus(results, nodeFailed), len(nodes))
 		}
-	},
+		// the other nodes are rolled back, nothing to reload
+		if !uploaded && policy == policyAllOrNothing {
+			return uploadExitCode(results)
+		}
+		// the reload only targets the servers of the changed files
+		changed := 0
+		for _, res := range results {
+			changed += res.Files
+		}
+		if uploaded && syncOnly && changed == 0 {
+			if isText() {
+				fmt.Println("all the files are up to date, nothing to reload")
+			}
+			return exitOK
+		}
+	}
+
+	// only tcm can reload config
+	if showDiff {
+		if ok := isDiffCompleted(env, s, &tcm); !ok {
+			report.Error = "diff failed"
+			return exitReload
+		}
+	}
+	if dryRun {
+		if ok := isPlanCompleted(env, s, &tcm); !ok {
+			report.Error = "plan failed"
+			return exitReload
+		}
+		return exitOK
+	}
+	if isReload {
+		if ok := isReloadCompleted(env, s, &tcm); !ok {
+			report.Error = "reload failed"
+			return exitReload
+		}
+	}
+	if !uploaded {
+		return uploadExitCode(results)
+	}
+	return exitOK
+}
+
+// fail records and logs the error which ends the run with code.
+func fail(code int, err error) int {
+	log.Errorf("%v", err)
+	report.Error = err.Error()
+	return code
+}
+
+// uploadExitCode tells whether the upload failed because of the login.
+func uploadExitCode(results []*nodeResult) int {
+	for _, res := range results {
+		if res.Status == nodeFailed && res.Err != errLoginFailed.Error() {
+			return exitUpload
+		}
+	}
+	return exitLogin
 }
 
 func Execute() {
@@ -180,38 +660,53 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(initConfig)
-	initLogger()
-	cfg, err := loadConfig()
-	if err != nil {
-		panic(err)
-	}
-	svrMap = cfg
+	initLogger(os.Stdout)
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", configFile, "the path of the config file of the envs")
 	rootCmd.Flags().StringVarP(&env, "env", "e", "dailybuild", "the name of target environment")
-	rootCmd.Flags().StringVarP(&file, "file", "f", "", "the absolute path of the configuration file to be uploaded")
+	rootCmd.Flags().StringVarP(&file, "file", "f", "", `the configuration file to be uploaded, or a directory or a glob such as "DB/*.db"
+whose files are uploaded under "dir" with their relative paths`)
 	rootCmd.Flags().StringVarP(&dir, "dir", "d", "", `the relative path of the uploaded configuration file or the uploaded configuration directory 
-which starts with "/wedo/ClientConfig" or "/wedo/ServerConfig"`)
+which starts with one of the "prefixes" of the env, "/wedo/ClientConfig" or "/wedo/ServerConfig" by default`)
 	rootCmd.Flags().BoolVarP(&isReload, "reload", "r", false, "whether to reload configurations")
+	rootCmd.Flags().BoolVar(&syncOnly, "sync", false, "only upload the files whose sha256 differs from the one on the node")
+	addTransferFlags(rootCmd.Flags())
+	rootCmd.Flags().BoolVar(&printTarget, "print-target", false, "print the path on the nodes of each file to be uploaded, without uploading")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the reload plan of the session instead of reloading configurations")
+	rootCmd.Flags().BoolVar(&showDiff, "diff", false, "print the changes of the tables and xml elements of the session before reloading")
+	rootCmd.Flags().BoolVar(&rollback, "rollback", false, `restore the files overwritten by the current or last reloaded session,
+and reload the affected servers if "reload" is set`)
+	rootCmd.Flags().StringVar(&canary, "canary", "", `with "reload", only reload this instance of the servers first, such as "1",
+the others are reloaded when the canary is promoted`)
+	rootCmd.Flags().DurationVar(&canaryWatch, "canary-watch", 0, "promote the canary once it ran this long without being aborted, 0 to promote it by hand")
+	rootCmd.Flags().BoolVar(&canaryPromote, "canary-promote", false, "reload the other instances of the last session reloaded with a canary")
+	rootCmd.Flags().BoolVar(&canaryAbort, "canary-abort", false, "restore the files of the last session reloaded with a canary and reload the canary")
 
 }
 
-func initConfig() {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".demo")
-	}
+// addTransferFlags adds the flags of the uploads to the nodes, shared by
+// the commands which upload.
+func addTransferFlags(flags *pflag.FlagSet) {
+	flags.IntVarP(&workers, "workers", "w", 4, "the number of nodes uploaded to concurrently")
+	flags.StringVar(&policy, "policy", policyAllOrNothing, `what to do when the upload to a node fails: "all-or-nothing" rolls back
+the other nodes, "best-effort" keeps them and reloads anyway`)
+	flags.BoolVar(&saveCredentials, "save-credentials", false, "save the credentials entered at the prompt in the encrypted keystore")
+	flags.DurationVar(&timeout, "timeout", time.Minute, "the timeout of the requests to the nodes without their own timeout, the file transfers only time out once idle for it")
+	flags.IntVar(&retries, "retries", 3, "how many times the requests failing with a network error or 5xx are retried")
+	flags.DurationVar(&retryWait, "retry-wait", time.Second, "the wait before the first retry, it doubles with each retry")
+	flags.Int64Var(&chunkSize, "chunk-size", 8<<20, `the files larger than this many bytes are uploaded in chunks, and resumed
+where they stopped if the connection drops, 0 disables it`)
+	flags.StringVarP(&output, "output", "o", outputText, `"text" for humans, or "json" to print one report of the run on stdout,
+the exit code is 1 for usage errors, 2 for login, 3 for upload, 4 for reload and 5 for rollback failures`)
+}
 
-	viper.AutomaticEnv()
+// configErr is why the config file could not be loaded, the commands
+// which need the envs fail with it.
+var configErr error
 
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+func initConfig() {
+	svrMap, configErr = loadConfig()
+	if svrMap == nil {
+		svrMap = map[string]Server{}
 	}
 }
 
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode is a node which logs in anyone and records the requests, the
+// test handles the other ones.
+type fakeNode struct {
+	*http.ServeMux
+	Socket Socket
+
+	mu        sync.Mutex
+	rollbacks []string // uuids of the rolled back sessions
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	n := &fakeNode{ServeMux: http.NewServeMux(), Socket: Socket{Username: "admin", Password: "admin"}}
+	n.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jwt"))
+	})
+	n.HandleFunc("/api/renew", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jwt"))
+	})
+	n.HandleFunc("/api/reload/rollback", func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		n.rollbacks = append(n.rollbacks, r.URL.Query().Get("uuid"))
+		n.mu.Unlock()
+		w.Write([]byte(`{"status":"OK","msg":[]}`))
+	})
+
+	srv := httptest.NewServer(n)
+	t.Cleanup(srv.Close)
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	n.Socket.IP = host
+	n.Socket.Port, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	return n
+}
+
+func (n *fakeNode) rolledBack() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.rollbacks...)
+}
+
+// setFlags sets the flags of the test, they are restored after it.
+func setFlags(t *testing.T) {
+	saved := []interface{}{policy, workers, retries, retryWait, timeout, chunkSize, syncOnly, output}
+	t.Cleanup(func() {
+		policy, workers, retries, retryWait = saved[0].(string), saved[1].(int), saved[2].(int), saved[3].(time.Duration)
+		timeout, chunkSize, syncOnly, output = saved[4].(time.Duration), saved[5].(int64), saved[6].(bool), saved[7].(string)
+		report = &runReport{Login: []*loginResult{}}
+	})
+	policy, workers, retries, retryWait = policyAllOrNothing, 1, 0, time.Millisecond
+	timeout, chunkSize, syncOnly, output = 5*time.Second, 0, false, outputJSON
+	report = &runReport{Login: []*loginResult{}}
+}
+
+func newTestStore(t *testing.T) *Store {
+	st := NewStore(filepath.Join(t.TempDir(), "tokens"))
+	t.Cleanup(func() { st.file.Close() })
+	return st
+}
+
+func writeFiles(t *testing.T, names ...string) []localFile {
+	dir := t.TempDir()
+	files := []localFile{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(name), 0644))
+		files = append(files, localFile{Path: path, Remote: "/ClientConfig/" + name})
+	}
+	return files
+}
+
+func TestUploadRollsBackPartialNodes(t *testing.T) {
+	setFlags(t)
+	st := newTestStore(t)
+	files := writeFiles(t, "a.xml", "b.xml")
+
+	ok := newFakeNode(t)
+	ok.HandleFunc("/api/resources/", func(w http.ResponseWriter, r *http.Request) {})
+	// the node fails after storing the first file
+	partial := newFakeNode(t)
+	partial.HandleFunc("/api/resources/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/resources/ClientConfig/b.xml" {
+			http.Error(w, "disk full", http.StatusConflict)
+		}
+	})
+
+	uploaded, results := isUploadCompleted("test", st, []Socket{ok.Socket, partial.Socket}, files, "/ClientConfig")
+	assert.False(t, uploaded)
+	require.Len(t, results, 2)
+	assert.Equal(t, nodeRolledBack, results[0].Status)
+	assert.Equal(t, nodeFailed, results[1].Status)
+	assert.Equal(t, 1, results[1].Files)
+	assert.Contains(t, results[1].Err, "rolled back")
+
+	assert.Len(t, ok.rolledBack(), 1)
+	assert.Len(t, partial.rolledBack(), 1)
+	assert.NotEmpty(t, partial.rolledBack()[0])
+	assert.Equal(t, exitUpload, uploadExitCode(results))
+}
+
+func TestRollbackNodesSkipsLoginFailures(t *testing.T) {
+	setFlags(t)
+	st := newTestStore(t)
+	node := newFakeNode(t)
+	st.SetUuid("test", node.Socket.GetUrl(), "stale")
+
+	results := []*nodeResult{{Node: &node.Socket, Status: nodeFailed, Err: errLoginFailed.Error()}}
+	rollbackNodes("test", st, results)
+	assert.Empty(t, node.rolledBack())
+	assert.Equal(t, errLoginFailed.Error(), results[0].Err)
+	assert.Equal(t, exitLogin, uploadExitCode(results))
+}
+
+func TestUploadNodeSync(t *testing.T) {
+	setFlags(t)
+	syncOnly = true
+	st := newTestStore(t)
+	files := writeFiles(t, "same.xml", "changed.xml", "added.xml")
+	for i := range files {
+		var err error
+		files[i].SHA256, err = fileSHA256(files[i].Path)
+		require.NoError(t, err)
+	}
+
+	node := newFakeNode(t)
+	var uploaded []string
+	node.HandleFunc("/api/resources/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			uploaded = append(uploaded, r.URL.Path)
+			return
+		}
+		assert.Equal(t, "sha256", r.URL.Query().Get("checksum"))
+		switch r.URL.Path {
+		case "/api/resources/ClientConfig/same.xml":
+			w.Write([]byte(`{"checksums":{"sha256":"` + files[0].SHA256 + `"}}`))
+		case "/api/resources/ClientConfig/changed.xml":
+			w.Write([]byte(`{"checksums":{"sha256":"0000"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	res := &nodeResult{Node: &node.Socket}
+	require.NoError(t, uploadNode("test", st, &node.Socket, files, "/ClientConfig", res))
+	assert.Equal(t, []string{"/api/resources/ClientConfig/changed.xml", "/api/resources/ClientConfig/added.xml"}, uploaded)
+	assert.Equal(t, 1, res.Unchanged)
+	assert.Equal(t, 2, res.Files)
+	assert.Equal(t, []string{"M /ClientConfig/changed.xml", "A /ClientConfig/added.xml"}, res.Changes)
+
+	// a node which cannot tell the checksum fails rather than uploading blindly
+	broken := newFakeNode(t)
+	broken.HandleFunc("/api/resources/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	err := uploadNode("test", st, &broken.Socket, files, "/ClientConfig", &nodeResult{Node: &broken.Socket})
+	assert.EqualError(t, err, "checksum /ClientConfig/same.xml: 403")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mapping maps a local file to its path on the nodes: if the local path
+// contains Match, the part of the local path starting at From is joined
+// to Target.
+type Mapping struct {
+	Match  string `json:"match"`
+	From   string `json:"from"`   // defaults to Match
+	Target string `json:"target"` // remote directory, e.g. /wedo
+}
+
+// defaultMappings are used by the environments which declare no mappings.
+var defaultMappings = []Mapping{
+	{Match: "ClientConfig", Target: "/wedo"},
+	{Match: "Common", From: "DB", Target: "/wedo/ClientConfig/CSCommon"},
+	{Match: "ServerConfig", Target: "/wedo"},
+}
+
+// defaultPrefixes are used by the environments which declare no prefixes.
+var defaultPrefixes = []string{"/wedo/ClientConfig", "/wedo/ServerConfig"}
+
+func (m Mapping) String() string {
+	return fmt.Sprintf("{match: %s, from: %s, target: %s}", m.Match, m.from(), m.Target)
+}
+
+func (m *Mapping) from() string {
+	if m.From == "" {
+		return m.Match
+	}
+	return m.From
+}
+
+// remote returns the path of the local file p on the nodes, or false if
+// the mapping does not apply to it.
+func (m *Mapping) remote(p string) (string, bool) {
+	if !strings.Contains(p, m.Match) {
+		return "", false
+	}
+	idx := strings.Index(p, m.from())
+	if idx < 0 {
+		return "", false
+	}
+	return path.Join(m.Target, filepath.ToSlash(p[idx:])), true
+}
+
+func (m *Mapping) validate() error {
+	if m.Match == "" {
+		return fmt.Errorf("mapping %v: match is empty", m)
+	}
+	if !path.IsAbs(m.Target) {
+		return fmt.Errorf("mapping %v: target must be an absolute path", m)
+	}
+	return nil
+}
+
+// mappings returns the mapping rules of the environment.
+func (s *Server) mappings() []Mapping {
+	if len(s.Mappings) == 0 {
+		return defaultMappings
+	}
+	return s.Mappings
+}
+
+// prefixes returns the remote directories files can be uploaded to.
+func (s *Server) prefixes() []string {
+	if len(s.Prefixes) == 0 {
+		return defaultPrefixes
+	}
+	return s.Prefixes
+}
+
+// validate checks the sockets, mapping rules and prefixes of the
+// environment.
+func (s *Server) validate() error {
+	if err := s.Tcm.validate(); err != nil {
+		return fmt.Errorf("tcm: %v", err)
+	}
+	for i := range s.Nodes {
+		if err := s.Nodes[i].validate(); err != nil {
+			return fmt.Errorf("node %s: %v", s.Nodes[i].GetUrl(), err)
+		}
+	}
+	for i := range s.Mappings {
+		if err := s.Mappings[i].validate(); err != nil {
+			return err
+		}
+	}
+	for _, prefix := range s.Prefixes {
+		if !path.IsAbs(prefix) {
+			return fmt.Errorf("prefix %s must be an absolute path", prefix)
+		}
+	}
+	return nil
+}
+
+// remotePath returns where a single file is uploaded according to the
+// first mapping rule which applies to its local path.
+func (s *Server) remotePath(p string) (string, error) {
+	for _, m := range s.mappings() {
+		if remote, ok := m.remote(p); ok {
+			return remote, nil
+		}
+	}
+	return "", fmt.Errorf("no mapping rule matches %s, the rules are: %v", p, s.mappings())
+}
+
+// checkPrefix returns an error if p is outside the allowed directories.
+func (s *Server) checkPrefix(p string) error {
+	for _, prefix := range s.prefixes() {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is outside the allowed directories: %s", p, strings.Join(s.prefixes(), ", "))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemotePath(t *testing.T) {
+	custom := &Server{Mappings: []Mapping{
+		{Match: "Tables", From: "Tables", Target: "/game/data"},
+		{Match: "ClientConfig", Target: "/game"},
+	}}
+	tests := []struct {
+		name   string
+		svr    *Server
+		local  string
+		remote string
+		err    bool
+	}{
+		{"client config", &Server{}, "/home/me/ClientConfig/a.xml", "/wedo/ClientConfig/a.xml", false},
+		{"server config", &Server{}, "/home/me/ServerConfig/sub/b.xml", "/wedo/ServerConfig/sub/b.xml", false},
+		{"common db", &Server{}, "/home/me/Common/DB/item.db", "/wedo/ClientConfig/CSCommon/DB/item.db", false},
+		{"no rule", &Server{}, "/home/me/Other/c.xml", "", true},
+		{"first rule wins", custom, "/home/me/ClientConfig/Tables/t.xml", "/game/data/Tables/t.xml", false},
+		{"second rule", custom, "/home/me/ClientConfig/a.xml", "/game/ClientConfig/a.xml", false},
+		{"custom rules replace the defaults", custom, "/home/me/ServerConfig/b.xml", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, err := tt.svr.remotePath(tt.local)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.remote, remote)
+		})
+	}
+}
+
+func TestCheckPrefix(t *testing.T) {
+	def := &Server{}
+	assert.NoError(t, def.checkPrefix("/wedo/ClientConfig"))
+	assert.NoError(t, def.checkPrefix("/wedo/ServerConfig/a.xml"))
+	assert.Error(t, def.checkPrefix("/wedo/ClientConfigOld/a.xml"))
+	assert.Error(t, def.checkPrefix("/etc/passwd"))
+
+	custom := &Server{Prefixes: []string{"/game/"}}
+	assert.NoError(t, custom.checkPrefix("/game/a.xml"))
+	assert.Error(t, custom.checkPrefix("/wedo/ClientConfig/a.xml"))
+}
+
+func TestServerValidate(t *testing.T) {
+	assert.NoError(t, (&Server{Mappings: []Mapping{{Match: "DB", Target: "/wedo"}}}).validate())
+	assert.Error(t, (&Server{Mappings: []Mapping{{Target: "/wedo"}}}).validate())
+	assert.Error(t, (&Server{Mappings: []Mapping{{Match: "DB", Target: "wedo"}}}).validate())
+	assert.Error(t, (&Server{Prefixes: []string{"wedo"}}).validate())
+}
+
+func TestCollectFiles(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "ClientConfig")
+	for _, name := range []string{"a.xml", "sub/b.xml", ".hidden/c.xml", "d.db"} {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	}
+	svr := &Server{}
+	remotes := func(files []localFile) []string {
+		out := []string{}
+		for _, f := range files {
+			out = append(out, f.Remote)
+		}
+		return out
+	}
+
+	// a single file follows the mapping rules
+	files, err := collectFiles(svr, filepath.Join(root, "a.xml"), "/ignored")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/wedo/ClientConfig/a.xml"}, remotes(files))
+
+	// a directory keeps its tree under dir, without the hidden files
+	files, err = collectFiles(svr, root, "/wedo/ClientConfig")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/wedo/ClientConfig/a.xml", "/wedo/ClientConfig/d.db", "/wedo/ClientConfig/sub/b.xml"}, remotes(files))
+
+	files, err = collectFiles(svr, filepath.Join(root, "*.xml"), "/wedo/ClientConfig")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/wedo/ClientConfig/a.xml"}, remotes(files))
+
+	_, err = collectFiles(svr, filepath.Join(root, "*.txt"), "/wedo/ClientConfig")
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/filebrowser/filebrowser/v2/reload"
+)
+
+// output formats
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// exit codes by failure class
+const (
+	exitOK       = 0
+	exitUsage    = 1 // invalid flags, config or local files
+	exitLogin    = 2
+	exitUpload   = 3
+	exitReload   = 4
+	exitRollback = 5
+)
+
+// runReport is the document printed by --output json, with the results of
+// each step per node.
+type runReport struct {
+	Env       string          `json:"env"`
+	Login     []*loginResult  `json:"login"`
+	Upload    []*nodeResult   `json:"upload,omitempty"`
+	Rollback  []*reloadResult `json:"rollback,omitempty"`
+	Diff      json.RawMessage `json:"diff,omitempty"`
+	Plan      json.RawMessage `json:"plan,omitempty"`
+	Reload    *reloadResult   `json:"reload,omitempty"`
+	Promotion *promotion      `json:"promotion,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ExitCode  int             `json:"exitCode"`
+
+	mu sync.Mutex
+}
+
+type loginResult struct {
+	Node  string `json:"node"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// reloadResult is the outcome of a reload or a rollback on a node.
+type reloadResult struct {
+	Node       string           `json:"node"`
+	HTTPStatus int              `json:"httpStatus,omitempty"`
+	Status     string           `json:"status,omitempty"`
+	Lines      []string         `json:"lines"`
+	Results    []*reload.Result `json:"results,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// parseBody fills the result with the response of a reload or rollback,
+// which is kept as is if it is not JSON.
+func (r *reloadResult) parseBody(body string) {
+	rsp := struct {
+		Status  string           `json:"status"`
+		Msg     []string         `json:"msg"`
+		Results []*reload.Result `json:"results"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &rsp); err != nil {
+		r.Lines = append(r.Lines, body)
+		return
+	}
+	r.Status = rsp.Status
+	r.Lines = append(r.Lines, rsp.Msg...)
+	r.Results = append(r.Results, rsp.Results...)
+}
+
+var report = &runReport{Login: []*loginResult{}}
+
+func (r *runReport) addLogin(so *Socket, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := &loginResult{Node: so.GetUrl(), OK: err == nil}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	r.Login = append(r.Login, res)
+}
+
+func (r *runReport) addRollback(res *reloadResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Rollback = append(r.Rollback, res)
+}
+
+func (res *nodeResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Node       string   `json:"node"`
+		Status     string   `json:"status"`
+		Files      int      `json:"files"`
+		Bytes      int64    `json:"bytes"`
+		DurationMS int64    `json:"durationMs"`
+		Error      string   `json:"error,omitempty"`
+		Unchanged  int      `json:"unchanged,omitempty"`
+		Changes    []string `json:"changes,omitempty"`
+	}{
+		Node:       res.Node.GetUrl(),
+		Status:     res.Status,
+		Files:      res.Files,
+		Bytes:      res.Bytes,
+		DurationMS: res.Duration.Milliseconds(),
+		Error:      res.Err,
+		Unchanged:  res.Unchanged,
+		Changes:    res.Changes,
+	})
+}
+
+// isText tells whether the results are printed for humans.
+func isText() bool {
+	return output != outputJSON
+}
+
+// finish prints the report with --output json and exits with code.
+func finish(code int) {
+	if output == outputJSON {
+		report.ExitCode = code
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(report); err != nil {
+			log.Errorf("encode report failed: %v", err)
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadResultParseBody(t *testing.T) {
+	rr := &reloadResult{Lines: []string{}}
+	rr.parseBody(`{"status":"OK","msg":["reload GameSvr"],"results":[{"proc":"1.1.13.1","status":"succeed"}]}`)
+	assert.Equal(t, "OK", rr.Status)
+	assert.Equal(t, []string{"reload GameSvr"}, rr.Lines)
+	require.Len(t, rr.Results, 1)
+
+	// the bodies of the old nodes are kept as is
+	rr = &reloadResult{Lines: []string{}}
+	rr.parseBody("reload succeed")
+	assert.Empty(t, rr.Status)
+	assert.Equal(t, []string{"reload succeed"}, rr.Lines)
+}
+
+func TestReportJSON(t *testing.T) {
+	ok := &Socket{IP: "10.0.0.1", Port: 8080}
+	down := &Socket{IP: "10.0.0.2", Port: 8080}
+	r := &runReport{Env: "dev", Login: []*loginResult{}}
+	r.addLogin(ok, nil)
+	r.addLogin(down, errors.New("connection refused"))
+	r.Upload = []*nodeResult{
+		{Node: ok, Status: nodeOK, Files: 2, Bytes: 10, Duration: 1500 * time.Millisecond, Changes: []string{"A /a.xml"}},
+		{Node: down, Status: nodeFailed, Err: errLoginFailed.Error()},
+	}
+	r.ExitCode = exitLogin
+
+	b, err := json.Marshal(r)
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &doc))
+
+	assert.Equal(t, "dev", doc["env"])
+	assert.Equal(t, float64(exitLogin), doc["exitCode"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"node": "http://10.0.0.1:8080", "ok": true},
+		map[string]interface{}{"node": "http://10.0.0.2:8080", "ok": false, "error": "connection refused"},
+	}, doc["login"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"node": "http://10.0.0.1:8080", "status": "ok", "files": float64(2), "bytes": float64(10),
+			"durationMs": float64(1500), "changes": []interface{}{"A /a.xml"}},
+		map[string]interface{}{"node": "http://10.0.0.2:8080", "status": "failed", "files": float64(0), "bytes": float64(0),
+			"durationMs": float64(0), "error": "login failed"},
+	}, doc["upload"])
+	// the steps which did not run are left out
+	assert.NotContains(t, doc, "reload")
+	assert.NotContains(t, doc, "rollback")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// upload policies when the upload to a node fails
+const (
+	policyBestEffort   = "best-effort"
+	policyAllOrNothing = "all-or-nothing"
+)
+
+// status of a node in the summary
+const (
+	nodeOK         = "ok"
+	nodeFailed     = "failed"
+	nodeSkipped    = "skipped"
+	nodeRolledBack = "rolled back"
+)
+
+type nodeResult struct {
+	Node      *Socket
+	Status    string
+	Files     int
+	Bytes     int64
+	Duration  time.Duration
+	Err       string
+	Unchanged int      // files skipped by --sync
+	Changes   []string // files uploaded by --sync, "A" if added or "M" if modified
+}
+
+// runNodes calls fn for each node with at most workers calls at a time.
+// Once stop returns true, the nodes which are not started yet are skipped.
+func runNodes(nodes []Socket, workers int, stop func() bool, fn func(so *Socket, res *nodeResult) error) []*nodeResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]*nodeResult, len(nodes))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := results[i]
+				if stop() {
+					res.Status = nodeSkipped
+					continue
+				}
+				start := time.Now()
+				if err := fn(res.Node, res); err != nil {
+					res.Status = nodeFailed
+					res.Err = err.Error()
+				} else {
+					res.Status = nodeOK
+				}
+				res.Duration = time.Since(start)
+			}
+		}()
+	}
+
+	for i := range nodes {
+		results[i] = &nodeResult{Node: &nodes[i]}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func countStatus(results []*nodeResult, status string) int {
+	n := 0
+	for _, res := range results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func printSummary(results []*nodeResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Node\tStatus\tFiles\tBytes\tDuration\tError")
+	for _, res := range results {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", res.Node.GetUrl(), res.Status, res.Files, res.Bytes,
+			res.Duration.Round(time.Millisecond), res.Err)
+	}
+	w.Flush()
+}
+
+func printDiff(results []*nodeResult) {
+	for _, res := range results {
+		fmt.Printf("%s: %d added, %d modified, %d unchanged\n", res.Node.GetUrl(),
+			countPrefix(res.Changes, "A "), countPrefix(res.Changes, "M "), res.Unchanged)
+		for _, change := range res.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+}
+
+func countPrefix(strs []string, prefix string) int {
+	n := 0
+	for _, s := range strs {
+		if strings.HasPrefix(s, prefix) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// promotion records where the promoted files come from, it is saved in the
+// promotions directory of the user config dir.
+type promotion struct {
+	Time   time.Time       `json:"time"`
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Source string          `json:"source"` // the node the files are downloaded from
+	Dir    string          `json:"dir"`
+	UUID   string          `json:"uuid"` // the upload session on the tcm of the target env
+	Files  []*promotedFile `json:"files"`
+}
+
+type promotedFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"` // of the file in the source env
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "copy a config set from an env to another",
+	Long: `copy the files of a directory, or a file, from the tcm of an env to the nodes
+of another. Only the files which differ on the target nodes are uploaded, in
+one session, and reloaded if "reload" is set. The checksums of the source
+files are saved in the promotions directory of the user config dir.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		finish(promote(cmd))
+	},
+}
+
+func promote(cmd *cobra.Command) int {
+	if output != outputText && output != outputJSON {
+		log.Errorf("unknown output: %s", output)
+		cmd.Help()
+		return exitUsage
+	}
+	// stdout is only for the report
+	if !isText() {
+		initLogger(os.Stderr)
+	}
+	from := mustGetString(cmd, "from")
+	to := mustGetString(cmd, "to")
+	remote := path.Clean("/" + mustGetString(cmd, "dir"))
+	if from == "" || to == "" || remote == "/" {
+		cmd.Help()
+		return exitUsage
+	}
+	if configErr != nil {
+		return fail(exitUsage, configErr)
+	}
+	src, found := svrMap[from]
+	if !found {
+		return fail(exitUsage, fmt.Errorf("env: %s not found", from))
+	}
+	dst, found := svrMap[to]
+	if !found {
+		return fail(exitUsage, fmt.Errorf("env: %s not found", to))
+	}
+	if err := dst.checkPrefix(remote); err != nil {
+		return fail(exitUsage, fmt.Errorf("dir: %v", err))
+	}
+
+	// the files identical on the target nodes are not uploaded
+	env = to
+	syncOnly = true
+	report.Env = to
+
+	st := openStore()
+	defer st.Save()
+
+	source := src.Tcm
+	if !isLoginCompleted(from, st, &source) {
+		return fail(exitLogin, fmt.Errorf("login tcm %v of %s failed", source, from))
+	}
+
+	tmp, err := ioutil.TempDir("", "upload-promote")
+	if err != nil {
+		return fail(exitUsage, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	jwt := st.GetJwt(from, source.GetUrl())
+	files, dir, err := downloadTree(&source, jwt, remote, tmp)
+	if err != nil {
+		return fail(exitUpload, fmt.Errorf("download from %s: %v", source.GetUrl(), err))
+	}
+	if len(files) == 0 {
+		return fail(exitUsage, fmt.Errorf("no file to promote in %s", remote))
+	}
+
+	p := &promotion{
+		Time:   time.Now(),
+		From:   from,
+		To:     to,
+		Source: source.GetUrl(),
+		Dir:    remote,
+	}
+	for _, f := range files {
+		p.Files = append(p.Files, &promotedFile{Path: f.Remote, SHA256: f.SHA256})
+	}
+	report.Promotion = p
+	if isText() {
+		fmt.Printf("%d files downloaded from %s of %s\n", len(files), source.GetUrl(), from)
+	}
+
+	tcm := dst.Tcm
+	if !isLoginCompleted(to, st, &tcm) {
+		return fail(exitLogin, fmt.Errorf("login tcm %v of %s failed", tcm, to))
+	}
+	p.UUID = st.GetUuid(to, tcm.GetUrl())
+
+	uploaded, results := isUploadCompleted(to, st, dst.Nodes, files, dir)
+	if !uploaded {
+		report.Error = fmt.Sprintf("upload failed on %d of %d nodes", countStatus(results, nodeFailed), len(dst.Nodes))
+		if policy == policyAllOrNothing {
+			return uploadExitCode(results)
+		}
+	}
+	changed := 0
+	for _, res := range results {
+		changed += res.Files
+	}
+	if uploaded && changed == 0 {
+		if isText() {
+			fmt.Printf("%s is up to date with %s, nothing to promote\n", to, from)
+		}
+		return exitOK
+	}
+
+	if name, err := savePromotion(p); err != nil {
+		log.Errorf("save promotion failed: %v", err)
+	} else if isText() {
+		fmt.Printf("source checksums saved in %s\n", name)
+	}
+
+	if mustGetBool(cmd, "reload") {
+		if ok := isReloadCompleted(to, st, &tcm); !ok {
+			report.Error = "reload failed"
+			return exitReload
+		}
+	}
+	if !uploaded {
+		return uploadExitCode(results)
+	}
+	return exitOK
+}
+
+// downloadTree downloads the file or the tree at remote under tmp. It
+// returns the files with their source checksums, and the upload directory
+// of the session.
+func downloadTree(so *Socket, jwt, remote, tmp string) ([]localFile, string, error) {
+	root, err := so.stat(remote, jwt)
+	if err != nil {
+		return nil, "", err
+	}
+	if !root.IsDir {
+		f, err := downloadFile(so, jwt, root.Path, tmp)
+		if err != nil {
+			return nil, "", err
+		}
+		return []localFile{f}, path.Dir(remote), nil
+	}
+
+	var files []localFile
+	var walk func(dir *remoteFile) error
+	walk = func(dir *remoteFile) error {
+		for _, item := range dir.Items {
+			// hidden files, e.g. the staged uploads, are not promoted
+			if strings.HasPrefix(item.Name, ".") {
+				continue
+			}
+			if !item.IsDir {
+				f, err := downloadFile(so, jwt, item.Path, tmp)
+				if err != nil {
+					return err
+				}
+				files = append(files, f)
+				continue
+			}
+			sub, err := so.stat(item.Path, jwt)
+			if err != nil {
+				return err
+			}
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return files, remote, walk(root)
+}
+
+func downloadFile(so *Socket, jwt, remote, tmp string) (localFile, error) {
+	f := localFile{Path: filepath.Join(tmp, filepath.FromSlash(remote)), Remote: remote}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return f, err
+	}
+	if err := so.download(remote, jwt, f.Path); err != nil {
+		return f, fmt.Errorf("%s: %v", remote, err)
+	}
+
+	var err error
+	f.SHA256, err = fileSHA256(f.Path)
+	return f, err
+}
+
+func savePromotion(p *promotion) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "promotions")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	b, err := json.MarshalIndent(p, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.json", p.Time.Format("20060102-150405"), p.From, p.To))
+	return name, ioutil.WriteFile(name, b, 0600)
+}
+
+func init() {
+	promoteCmd.Flags().String("from", "", "the env the files are copied from")
+	promoteCmd.Flags().String("to", "", "the env the files are copied to")
+	promoteCmd.Flags().String("dir", "", "the directory or the file to copy, e.g. /wedo/ClientConfig/CSCommon/DB")
+	promoteCmd.Flags().BoolP("reload", "r", false, "reload the target env once the files are uploaded")
+	// the files are uploaded as by the root command
+	addTransferFlags(promoteCmd.Flags())
+	rootCmd.AddCommand(promoteCmd)
+}
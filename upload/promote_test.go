@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadTree(t *testing.T) {
+	setFlags(t)
+	node := newFakeNode(t)
+	tree := map[string]*remoteFile{
+		"/wedo/ClientConfig": {Path: "/wedo/ClientConfig", IsDir: true, Items: []*remoteFile{
+			{Path: "/wedo/ClientConfig/a.xml", Name: "a.xml"},
+			{Path: "/wedo/ClientConfig/.staging", Name: ".staging", IsDir: true},
+			{Path: "/wedo/ClientConfig/sub", Name: "sub", IsDir: true},
+		}},
+		"/wedo/ClientConfig/sub": {Path: "/wedo/ClientConfig/sub", IsDir: true, Items: []*remoteFile{
+			{Path: "/wedo/ClientConfig/sub/b.db", Name: "b.db"},
+		}},
+		"/wedo/ClientConfig/a.xml": {Path: "/wedo/ClientConfig/a.xml", Name: "a.xml"},
+	}
+	node.HandleFunc("/api/resources/", func(w http.ResponseWriter, r *http.Request) {
+		f, found := tree[strings.TrimPrefix(r.URL.Path, "/api/resources")]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(f))
+	})
+	node.HandleFunc("/api/raw/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(filepath.Base(r.URL.Path)))
+	})
+
+	tmp := t.TempDir()
+	files, dir, err := downloadTree(&node.Socket, "jwt", "/wedo/ClientConfig", tmp)
+	require.NoError(t, err)
+	assert.Equal(t, "/wedo/ClientConfig", dir)
+	require.Len(t, files, 2)
+	assert.Equal(t, "/wedo/ClientConfig/a.xml", files[0].Remote)
+	assert.Equal(t, "/wedo/ClientConfig/sub/b.db", files[1].Remote)
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f.Path)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Base(f.Remote), string(b))
+		// the source checksums are recorded
+		assert.Equal(t, sha256Of(b), f.SHA256)
+	}
+
+	// a single file is uploaded in its directory
+	files, dir, err = downloadTree(&node.Socket, "jwt", "/wedo/ClientConfig/a.xml", t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "/wedo/ClientConfig", dir)
+	assert.Len(t, files, 1)
+
+	_, _, err = downloadTree(&node.Socket, "jwt", "/wedo/missing", t.TempDir())
+	assert.Error(t, err)
+}
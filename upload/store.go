@@ -1,105 +1,151 @@
 package main
 
 import (
-    "encoding/gob"
-    "io"
-    "os"
-    "sync"
+	"encoding/gob"
+	"io"
+	"os"
+	"sync"
 )
 
 type Store struct {
-    data map[string]map[string]*meta
-    mu   sync.RWMutex
-    file *os.File
+	data map[string]map[string]*meta
+	mu   sync.Mutex
+	file *os.File
 }
 
 type meta struct {
-    Url  string
-    Uuid string
-    Jwt  string
+	Url      string
+	Uuid     string
+	LastUuid string
+	Jwt      string
 }
 
 type record struct {
-    M map[string]map[string]*meta
+	M map[string]map[string]*meta
+}
+
+// legacyStore is where the jwts were cached, in the working directory.
+const legacyStore = ".tmp.gob"
+
+// openStore opens the token cache of the user.
+func openStore() *Store {
+	filename, err := tokensPath()
+	if err != nil {
+		log.Fatalf("open store failed: %v", err)
+	}
+	if _, err := os.Stat(legacyStore); err == nil {
+		log.Warningf("%s is no longer used, remove it with upload logout", legacyStore)
+	}
+	return NewStore(filename)
 }
 
 func NewStore(filename string) *Store {
-    s := &Store{data: make(map[string]map[string]*meta)}
-    f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
-    if err != nil {
-        log.Fatalf("open store failed:", err)
-    }
-    s.file = f
-    if err := s.load(); err != nil {
-        log.Fatalf("load store failed:", err)
-    }
-    os.Truncate(filename, 0)
-    return s
+	s := &Store{data: make(map[string]map[string]*meta)}
+	// the store holds the jwts, only the user can read it
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Fatalf("open store failed: %v", err)
+	}
+	if err := f.Chmod(0600); err != nil {
+		log.Fatalf("chmod store failed: %v", err)
+	}
+	s.file = f
+	if err := s.load(); err != nil {
+		log.Fatalf("load store failed: %v", err)
+	}
+	return s
 }
 
 func (s *Store) GetUuid(env, url string) string {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
-    if _, found := s.data[env]; !found {
-        s.data[env] = make(map[string]*meta)
-    }
-    if _, found := s.data[env][url]; !found {
-        s.data[env][url] = &meta{}
-    }
-    return s.data[env][url].Uuid
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta(env, url).Uuid
 }
 
 func (s *Store) SetUuid(env, url, uuid string) {
-    s.mu.Lock()
-    defer s.mu.Unlock()
-    if _, found := s.data[env]; !found {
-        s.data[env] = make(map[string]*meta)
-    }
-    if _, found := s.data[env][url]; !found {
-        s.data[env][url] = &meta{}
-    }
-    s.data[env][url].Uuid = uuid
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta(env, url).Uuid = uuid
+}
+
+// GetLastUuid returns the uuid of the last reloaded session, which can
+// still be rolled back.
+func (s *Store) GetLastUuid(env, url string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta(env, url).LastUuid
+}
+
+func (s *Store) SetLastUuid(env, url, uuid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta(env, url).LastUuid = uuid
 }
 
 func (s *Store) GetJwt(env, url string) string {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
-    if _, found := s.data[env]; !found {
-        s.data[env] = make(map[string]*meta)
-    }
-    if _, found := s.data[env][url]; !found {
-        s.data[env][url] = &meta{}
-    }
-    return s.data[env][url].Jwt
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta(env, url).Jwt
 }
 
 func (s *Store) SetJwt(env, url, jwt string) {
-    s.mu.Lock()
-    defer s.mu.Unlock()
-    if _, found := s.data[env]; !found {
-        s.data[env] = make(map[string]*meta)
-    }
-    if _, found := s.data[env][url]; !found {
-        s.data[env][url] = &meta{}
-    }
-    s.data[env][url].Jwt = jwt
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta(env, url).Jwt = jwt
+}
+
+// Logout forgets the jwts of the nodes of env, or of all the envs if env
+// is empty. The sessions are kept so that they can still be rolled back.
+func (s *Store) Logout(env string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for name, nodes := range s.data {
+		if env != "" && name != env {
+			continue
+		}
+		for _, m := range nodes {
+			if m.Jwt != "" {
+				m.Jwt = ""
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// meta returns the meta of the node of env, the caller holds the lock.
+func (s *Store) meta(env, url string) *meta {
+	if _, found := s.data[env]; !found {
+		s.data[env] = make(map[string]*meta)
+	}
+	if _, found := s.data[env][url]; !found {
+		s.data[env][url] = &meta{}
+	}
+	return s.data[env][url]
 }
 
 func (s *Store) load() error {
-    if _, err := s.file.Seek(0, 0); err != nil {
-        return err
-    }
-    d := gob.NewDecoder(s.file)
-    if err := d.Decode(&s.data); err != nil {
-        if err == io.EOF {
-            return nil
-        }
-        return err
-    }
-    return nil
+	if _, err := s.file.Seek(0, 0); err != nil {
+		return err
+	}
+	d := gob.NewDecoder(s.file)
+	if err := d.Decode(&s.data); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	return nil
 }
 
 func (s *Store) Save() error {
-    e := gob.NewEncoder(s.file)
-    return e.Encode(s.data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the file is only truncated here, so an exit without saving keeps it
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	e := gob.NewEncoder(s.file)
+	return e.Encode(s.data)
 }
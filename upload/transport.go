@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// validate checks the scheme and base url of the socket and loads its tls
+// config.
+func (s *Socket) validate() error {
+	switch s.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("unknown scheme %s", s.Scheme)
+	}
+
+	if s.BaseURL != "" {
+		s.BaseURL = "/" + strings.Trim(s.BaseURL, "/")
+	}
+
+	if (s.Cert == "") != (s.Key == "") {
+		return fmt.Errorf("cert and key must be set together")
+	}
+	if s.Scheme != "https" {
+		if s.CA != "" || s.Cert != "" {
+			return fmt.Errorf("ca and cert require the https scheme")
+		}
+		return nil
+	}
+
+	s.tls = &tls.Config{}
+	if s.CA != "" {
+		pem, err := ioutil.ReadFile(s.CA)
+		if err != nil {
+			return err
+		}
+		s.tls.RootCAs = x509.NewCertPool()
+		if !s.tls.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in ca %s", s.CA)
+		}
+	}
+	if s.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(s.Cert, s.Key)
+		if err != nil {
+			return err
+		}
+		s.tls.Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+func (s *Socket) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout) * time.Second
+	}
+	return timeout
+}
+
+var (
+	clientsMu sync.Mutex
+	// the clients by url, so that the connections are reused
+	clients = map[string]*http.Client{}
+	// the clients of the file transfers by url
+	transferClients = map[string]*http.Client{}
+)
+
+// client returns the client of the requests to the socket, which time out.
+func (s *Socket) client() *http.Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, found := clients[s.GetUrl()]; found {
+		return c
+	}
+
+	c := &http.Client{
+		Timeout: s.timeout(),
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     s.tls,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+	clients[s.GetUrl()] = c
+	return c
+}
+
+// transferClient returns the client of the uploads and downloads of files
+// to the socket. They last as long as the file takes, only a connection
+// idle for the timeout fails them.
+func (s *Socket) transferClient() *http.Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, found := transferClients[s.GetUrl()]; found {
+		return c
+	}
+
+	d := &net.Dialer{Timeout: s.timeout(), KeepAlive: 30 * time.Second}
+	idle := s.timeout()
+	c := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := d.DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				return &idleConn{Conn: conn, timeout: idle}, nil
+			},
+			TLSClientConfig:     s.tls,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+	transferClients[s.GetUrl()] = c
+	return c
+}
+
+// idleConn is a connection which fails once nothing is read or written
+// for timeout. Each read or write pushes back the deadline of both, so a
+// response awaited while the request body is sent does not time out.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// dialer returns the dialer of the WebSockets of the socket. Only the
+// handshake times out, a stream lasts as long as the reload.
+func (s *Socket) dialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  s.tls,
+		HandshakeTimeout: s.timeout(),
+	}
+}
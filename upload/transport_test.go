@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		so   Socket
+		err  bool
+	}{
+		{"http", Socket{}, false},
+		{"https with the system cas", Socket{Scheme: "https"}, false},
+		{"unknown scheme", Socket{Scheme: "ftp"}, true},
+		{"cert without key", Socket{Scheme: "https", Cert: "cert.pem"}, true},
+		{"ca over http", Socket{CA: "ca.pem"}, true},
+		{"missing ca", Socket{Scheme: "https", CA: "missing.pem"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.so.validate()
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	so := Socket{IP: "node", Port: 443, Scheme: "https", BaseURL: "files/"}
+	require.NoError(t, so.validate())
+	assert.Equal(t, "https://node:443/files", so.GetUrl())
+}
+
+func TestSocketCustomCA(t *testing.T) {
+	setFlags(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	// the certificate of the test server is not trusted by the system
+	so := &Socket{IP: host, Port: p, Scheme: "https", BaseURL: "/files"}
+	require.NoError(t, so.validate())
+	_, _, err = so.get("/api/version", "", false)
+	assert.Error(t, err)
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(ca, pemBytes, 0644))
+	// the clients are cached by url
+	so = &Socket{IP: host, Port: p, Scheme: "https", BaseURL: "/other", CA: ca}
+	require.NoError(t, so.validate())
+	status, body, err := so.get("/api/version", "", false)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "/other/api/version", body)
+}
@@ -0,0 +1,112 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// Timeout of a validator command.
+const Timeout = time.Minute
+
+// File runs the checks of the settings matching the extension of name on
+// the file at path, which is the uploaded version of name. The returned
+// error wraps errors.ErrInvalidConfig if the file is invalid.
+func File(v *settings.Validation, name, path string) error {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	if ext == ".xml" && !v.DisableXML {
+		if err := XML(path); err != nil {
+			return err
+		}
+	}
+
+	if ext == ".db" && v.SQLite != "" {
+		if err := SQLite(v.SQLite, path); err != nil {
+			return err
+		}
+	}
+
+	if cmd, ok := v.Commands[ext]; ok {
+		if err := Command(cmd, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// XML checks that the file is a well-formed XML document.
+func XML(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	root := false
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("malformed xml: %v: %w", err, errors.ErrInvalidConfig)
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			root = true
+		}
+	}
+
+	if !root {
+		return fmt.Errorf("xml without root element: %w", errors.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// SQLite checks the integrity of a SQLite database with the sqlite3 binary.
+func SQLite(bin, path string) error {
+	out, err := run([]string{bin, "-readonly", path, "PRAGMA integrity_check;"})
+	if _, ok := err.(*exec.ExitError); ok || (err == nil && out != "ok") {
+		return fmt.Errorf("sqlite integrity check failed: %s: %w", out, errors.ErrInvalidConfig)
+	}
+	return err
+}
+
+// Command checks the file with a validator command, in which "{file}" is
+// replaced by the path of the file.
+func Command(template []string, path string) error {
+	args := make([]string, len(template))
+	for i, arg := range template {
+		args[i] = strings.ReplaceAll(arg, "{file}", path)
+	}
+
+	out, err := run(args)
+	if _, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("%s rejected the file: %s: %w", args[0], out, errors.ErrInvalidConfig)
+	}
+	return err
+}
+
+func run(args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return strings.TrimSpace(out.String()), err
+}
@@ -0,0 +1,37 @@
+package validate
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	v := &settings.Validation{
+		Commands: map[string][]string{".db": {"sh", "-c", `grep -q valid "{file}"`}},
+	}
+
+	assert.NoError(t, File(v, "Item.xml", write("a", `<?xml version="1.0"?><root><a/></root>`)))
+	assert.True(t, errors.Is(File(v, "Item.xml", write("b", `<root><a></root>`)), libErrors.ErrInvalidConfig))
+	assert.True(t, errors.Is(File(v, "Item.xml", write("c", ``)), libErrors.ErrInvalidConfig))
+
+	assert.NoError(t, File(v, "Item.db", write("d", "valid")))
+	assert.True(t, errors.Is(File(v, "Item.db", write("e", "broken")), libErrors.ErrInvalidConfig))
+
+	v.DisableXML = true
+	assert.NoError(t, File(v, "Item.xml", write("f", `<root>`)))
+}